@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/nais/bifrost/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+}
+
+var repairCmd = &cobra.Command{
+	Use:   "repair <name>",
+	Short: "Repair an Unleash instance",
+	Long:  `Recreate any missing resources of a partially provisioned Unleash instance`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := config.New(cmd.Context())
+		logger, err := logging.New(config.Log.Level, config.Log.Format)
+		if err != nil {
+			return err
+		}
+
+		unleashService, err := server.InitUnleashService(cmd.Context(), config, logger)
+		if err != nil {
+			return err
+		}
+
+		repaired, err := unleashService.Repair(cmd.Context(), args[0])
+		for _, resource := range repaired {
+			fmt.Printf("Recreated %s\n", resource)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(repaired) == 0 {
+			fmt.Printf("Nothing to repair for %s\n", args[0])
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/nais/bifrost/pkg/server"
+	"github.com/nais/bifrost/pkg/unleash"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upgradeFilter      unleash.UpgradeFilter
+	upgradeConcurrency int
+	upgradeDryRun      bool
+)
+
+func init() {
+	upgradeCmd.Flags().StringVar(&upgradeFilter.OlderThan, "older-than", "", "only upgrade instances running a version older than this, e.g. 5.10.0")
+	upgradeCmd.Flags().StringVar(&upgradeFilter.Team, "team", "", "only upgrade instances the team is allowed to access")
+	upgradeCmd.Flags().StringVar(&upgradeFilter.NamePattern, "name", "", "only upgrade instances with a name matching the pattern, e.g. 'team-*'")
+	upgradeCmd.Flags().IntVar(&upgradeConcurrency, "concurrency", 0, "number of instances upgraded at the same time (default BIFROST_UNLEASH_UPGRADE_CONCURRENCY)")
+	upgradeCmd.Flags().BoolVar(&upgradeDryRun, "dry-run", false, "only print the instances that would be upgraded")
+
+	rootCmd.AddCommand(upgradeCmd)
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade <version>",
+	Short: "Upgrade Unleash instances",
+	Long:  `Set the custom version of all matching Unleash instances, waiting for each to become ready and halting on the first failure`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := config.New(cmd.Context())
+		logger, err := logging.New(config.Log.Level, config.Log.Format)
+		if err != nil {
+			return err
+		}
+
+		unleashService, err := server.InitUnleashService(cmd.Context(), config, logger)
+		if err != nil {
+			return err
+		}
+
+		plan, err := unleash.PlanUpgrade(cmd.Context(), unleashService, args[0], upgradeFilter)
+		if err != nil {
+			return err
+		}
+
+		if len(plan.Instances) == 0 {
+			fmt.Println("No instances to upgrade")
+			return nil
+		}
+
+		fmt.Printf("Upgrading %d instances to %s:\n", len(plan.Instances), plan.Version)
+		for _, planned := range plan.Instances {
+			fmt.Printf("  %s (%s)\n", planned.Name, planned.FromVersion)
+		}
+
+		if upgradeDryRun {
+			return nil
+		}
+
+		opts := unleash.UpgradeOptions{
+			Concurrency:  config.Unleash.UpgradeConcurrency,
+			ReadyTimeout: config.Unleash.UpgradeReadyTimeout,
+		}
+		if upgradeConcurrency > 0 {
+			opts.Concurrency = upgradeConcurrency
+		}
+
+		return unleash.RunUpgrade(cmd.Context(), unleashService, plan, opts, func(result unleash.UpgradeResult) {
+			if result.Error != "" {
+				fmt.Printf("%s: %s: %s\n", result.Name, result.Status, result.Error)
+				return
+			}
+			fmt.Printf("%s: %s\n", result.Name, result.Status)
+		})
+	},
+}
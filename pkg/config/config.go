@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -47,6 +48,18 @@ func (m *MetaConfig) VersionUrl() string {
 	return fmt.Sprintf("%s/releases/tag/%s", m.RepoUrl(), m.Version)
 }
 
+type LogConfig struct {
+	Level  string `env:"BIFROST_LOG_LEVEL,default=info"`
+	Format string `env:"BIFROST_LOG_FORMAT,default=json"`
+}
+
+// TracingConfig uses the standard OpenTelemetry variables. Traces are exported
+// over OTLP/HTTP when an endpoint is set.
+type TracingConfig struct {
+	Endpoint    string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName string `env:"OTEL_SERVICE_NAME,default=bifrost"`
+}
+
 type ServerConfig struct {
 	Port            string `env:"BIFROST_PORT,default=8080"`
 	Host            string `env:"BIFROST_HOST,default=0.0.0.0"`
@@ -61,33 +74,63 @@ type GoogleConfig struct {
 	ProjectID           string `env:"BIFROST_GOOGLE_PROJECT_ID,required"`
 	ProjectNumber       string `env:"BIFROST_GOOGLE_PROJECT_NUMBER,required"`
 	IAPBackendServiceID string `env:"BIFROST_GOOGLE_IAP_BACKEND_SERVICE_ID,required"`
+	IAPAuthEnabled      bool   `env:"BIFROST_GOOGLE_IAP_AUTH_ENABLED,default=true"`
+	IAPPublicKeysURL    string `env:"BIFROST_GOOGLE_IAP_PUBLIC_KEYS_URL,default=https://www.gstatic.com/iap/verify/public_key-jwk"`
 }
 
 type TeamsConfig struct {
-	TeamsApiURL   string `env:"BIFROST_TEAMS_API_URL,required"`
-	TeamsApiToken string `env:"BIFROST_TEAMS_API_TOKEN,required"`
+	TeamsApiURL          string        `env:"BIFROST_TEAMS_API_URL,required"`
+	TeamsApiToken        string        `env:"BIFROST_TEAMS_API_TOKEN,required"`
+	AuthorizationEnabled bool          `env:"BIFROST_TEAMS_AUTHORIZATION_ENABLED,default=true"`
+	AdminTeams           []string      `env:"BIFROST_TEAMS_ADMIN_TEAMS"`
+	ValidationEnabled    bool          `env:"BIFROST_TEAMS_VALIDATION_ENABLED,default=true"`
+	CacheTTL             time.Duration `env:"BIFROST_TEAMS_CACHE_TTL,default=5m"`
 }
 
-type UnleashConfig struct {
-	InstanceNamespace       string `env:"BIFROST_UNLEASH_INSTANCE_NAMESPACE,required"`
-	InstanceServiceaccount  string `env:"BIFROST_UNLEASH_INSTANCE_SERVICEACCOUNT,required"`
-	SQLInstanceID           string `env:"BIFROST_UNLEASH_SQL_INSTANCE_ID,required"`
-	SQLInstanceRegion       string `env:"BIFROST_UNLEASH_SQL_INSTANCE_REGION,required"`
-	SQLInstanceAddress      string `env:"BIFROST_UNLEASH_SQL_INSTANCE_ADDRESS,required"`
-	InstanceWebIngressHost  string `env:"BIFROST_UNLEASH_INSTANCE_WEB_INGRESS_HOST,required"`
-	InstanceWebIngressClass string `env:"BIFROST_UNLEASH_INSTANCE_WEB_INGRESS_CLASS,required"`
-	InstanceAPIIngressHost  string `env:"BIFROST_UNLEASH_INSTANCE_API_INGRESS_HOST,required"`
-	InstanceAPIIngressClass string `env:"BIFROST_UNLEASH_INSTANCE_API_INGRESS_CLASS,required"`
-	TeamsApiURL             string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_URL,required"`
-	TeamsApiSecretName      string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_SECRET_NAME,required"`
-	TeamsApiSecretTokenKey  string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_TOKEN_SECRET_KEY,required"`
+type GitHubConfig struct {
+	ApiURL   string        `env:"BIFROST_GITHUB_API_URL,default=https://api.github.com"`
+	Token    string        `env:"BIFROST_GITHUB_TOKEN"`
+	CacheTTL time.Duration `env:"BIFROST_GITHUB_CACHE_TTL,default=15m"`
 }
 
+type UnleashConfig struct {
+	InstanceNamespace       string        `env:"BIFROST_UNLEASH_INSTANCE_NAMESPACE,required"`
+	InstanceServiceaccount  string        `env:"BIFROST_UNLEASH_INSTANCE_SERVICEACCOUNT,required"`
+	SQLInstanceID           string        `env:"BIFROST_UNLEASH_SQL_INSTANCE_ID,required"`
+	SQLInstanceRegion       string        `env:"BIFROST_UNLEASH_SQL_INSTANCE_REGION,required"`
+	SQLInstanceAddress      string        `env:"BIFROST_UNLEASH_SQL_INSTANCE_ADDRESS,required"`
+	InstanceWebIngressHost  string        `env:"BIFROST_UNLEASH_INSTANCE_WEB_INGRESS_HOST,required"`
+	InstanceWebIngressClass string        `env:"BIFROST_UNLEASH_INSTANCE_WEB_INGRESS_CLASS,required"`
+	InstanceAPIIngressHost  string        `env:"BIFROST_UNLEASH_INSTANCE_API_INGRESS_HOST,required"`
+	InstanceAPIIngressClass string        `env:"BIFROST_UNLEASH_INSTANCE_API_INGRESS_CLASS,required"`
+	TeamsApiURL             string        `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_URL,required"`
+	TeamsApiSecretName      string        `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_SECRET_NAME,required"`
+	TeamsApiSecretTokenKey  string        `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_TOKEN_SECRET_KEY,required"`
+	FleetMetricsInterval    time.Duration `env:"BIFROST_UNLEASH_FLEET_METRICS_INTERVAL,default=1m"`
+	VersionSource           string        `env:"BIFROST_UNLEASH_VERSION_SOURCE,default=github"`
+	ImageRegistryCacheTTL   time.Duration `env:"BIFROST_UNLEASH_IMAGE_REGISTRY_CACHE_TTL,default=15m"`
+	UpgradeConcurrency      int           `env:"BIFROST_UNLEASH_UPGRADE_CONCURRENCY,default=1"`
+	UpgradeReadyTimeout     time.Duration `env:"BIFROST_UNLEASH_UPGRADE_READY_TIMEOUT,default=10m"`
+	AutoUpgradeInterval     time.Duration `env:"BIFROST_UNLEASH_AUTO_UPGRADE_INTERVAL,default=1h"`
+	AutoUpgradeWindow       string        `env:"BIFROST_UNLEASH_AUTO_UPGRADE_WINDOW"`
+	AutoUpgradeTimezone     string        `env:"BIFROST_UNLEASH_AUTO_UPGRADE_TIMEZONE,default=UTC"`
+}
+
+// Version sources for BIFROST_UNLEASH_VERSION_SOURCE.
+const (
+	VersionSourceGitHub    = "github"
+	VersionSourceRegistry  = "registry"
+	VersionSourceIntersect = "github-and-registry"
+)
+
 type Config struct {
 	Meta                MetaConfig
 	Server              ServerConfig
+	Log                 LogConfig
+	Tracing             TracingConfig
 	Google              GoogleConfig
 	Teams               TeamsConfig
+	GitHub              GitHubConfig
 	Unleash             UnleashConfig
 	DebugMode           bool
 	CloudConnectorProxy string `env:"BIFROST_CLOUD_CONNECTOR_PROXY_IMAGE,default=gcr.io/cloud-sql-connectors/cloud-sql-proxy:2.1.0"`
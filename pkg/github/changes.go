@@ -0,0 +1,218 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ChangelogProvider describes what changed between two Unleash versions.
+type ChangelogProvider interface {
+	UnleashChanges(ctx context.Context, base, head string) (*Changes, error)
+}
+
+type Commit struct {
+	Sha     string    `json:"sha"`
+	Message string    `json:"message"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Url     string    `json:"url"`
+}
+
+type Release struct {
+	Tag         string    `json:"tag"`
+	Name        string    `json:"name"`
+	Body        string    `json:"body"`
+	Url         string    `json:"url"`
+	PublishedAt time.Time `json:"published-at"`
+}
+
+// Changes are the commits and releases between two tags. When head is older
+// than base, Downgrade is set and the changes are the ones that would be
+// reverted. Truncated is set when there were more commits than could be
+// listed, the full comparison is at Url.
+type Changes struct {
+	Base      string    `json:"base"`
+	Head      string    `json:"head"`
+	Downgrade bool      `json:"downgrade"`
+	Url       string    `json:"url"`
+	Commits   []Commit  `json:"commits"`
+	Truncated bool      `json:"truncated"`
+	Releases  []Release `json:"releases"`
+}
+
+// UnleashChanges compares two nais/unleash tags.
+func (c *Client) UnleashChanges(ctx context.Context, base, head string) (*Changes, error) {
+	baseVersion, err := tagToUnleashVersion(base)
+	if err != nil {
+		return nil, err
+	}
+
+	headVersion, err := tagToUnleashVersion(head)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &Changes{Base: base, Head: head}
+
+	older, newer := baseVersion, headVersion
+	if baseVersion.IsNewerThan(headVersion) {
+		changes.Downgrade = true
+		older, newer = headVersion, baseVersion
+	}
+
+	changes.Url, changes.Commits, changes.Truncated, err = c.compare(ctx, unleashRepoOwner, unleashRepoName, older.GitTag, newer.GitTag)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := c.releases(ctx, unleashRepoOwner, unleashRepoName, older)
+	if err != nil {
+		return nil, err
+	}
+
+	changes.Releases = []Release{}
+	for _, release := range releases {
+		version, err := tagToUnleashVersion(release.Tag)
+		if err != nil {
+			continue
+		}
+
+		if version.IsNewerThan(older) && !version.IsNewerThan(newer) {
+			changes.Releases = append(changes.Releases, release)
+		}
+	}
+
+	return changes, nil
+}
+
+// getJSON fetches url and decodes it into out, and returns the URL of the next
+// page, if any. The last response is used when GitHub cannot be reached or the
+// rate limit is exhausted.
+func (c *Client) getJSON(ctx context.Context, url string, out interface{}) (string, error) {
+	cached, ok := c.cachedResponse(url)
+
+	c.mu.Lock()
+	rateLimitedUntil := c.rateLimitedUntil
+	c.mu.Unlock()
+
+	if c.now().Before(rateLimitedUntil) {
+		if !ok {
+			return "", fmt.Errorf("github rate limit exceeded until %s", rateLimitedUntil.Format(time.RFC3339))
+		}
+		return cached.next, json.Unmarshal(cached.body, out)
+	}
+
+	resp, err := c.fetch(ctx, url)
+	if err != nil {
+		if !ok {
+			return "", err
+		}
+		resp = cached
+	}
+
+	return resp.next, json.Unmarshal(resp.body, out)
+}
+
+// compare returns the commits between base and head newest first, following
+// pagination for up to maxTagPages pages. truncated is set when there were
+// more pages.
+func (c *Client) compare(ctx context.Context, owner, repo, base, head string) (htmlUrl string, commits []Commit, truncated bool, err error) {
+	compareUrl := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s?per_page=%d", c.apiUrl, owner, repo, url.PathEscape(base), url.PathEscape(head), tagsPerPage)
+	pages := [][]Commit{}
+
+	for i := 0; compareUrl != "" && i < maxTagPages; i++ {
+		var res struct {
+			HtmlUrl string `json:"html_url"`
+			Commits []struct {
+				Sha     string `json:"sha"`
+				HtmlUrl string `json:"html_url"`
+				Commit  struct {
+					Message string `json:"message"`
+					Author  struct {
+						Name string    `json:"name"`
+						Date time.Time `json:"date"`
+					} `json:"author"`
+				} `json:"commit"`
+			} `json:"commits"`
+		}
+
+		next, err := c.getJSON(ctx, compareUrl, &res)
+		if err != nil {
+			return "", nil, false, err
+		}
+		compareUrl = next
+
+		if htmlUrl == "" {
+			htmlUrl = res.HtmlUrl
+		}
+
+		// GitHub lists commits oldest first, we show the newest first.
+		page := make([]Commit, 0, len(res.Commits))
+		for j := len(res.Commits) - 1; j >= 0; j-- {
+			commit := res.Commits[j]
+			page = append(page, Commit{
+				Sha:     commit.Sha,
+				Message: strings.SplitN(commit.Commit.Message, "\n", 2)[0],
+				Author:  commit.Commit.Author.Name,
+				Date:    commit.Commit.Author.Date,
+				Url:     commit.HtmlUrl,
+			})
+		}
+		pages = append(pages, page)
+	}
+
+	commits = []Commit{}
+	for i := len(pages) - 1; i >= 0; i-- {
+		commits = append(commits, pages[i]...)
+	}
+
+	return htmlUrl, commits, compareUrl != "", nil
+}
+
+// releases returns the published releases newest first, following pagination
+// until a page lists a release that is not newer than since.
+func (c *Client) releases(ctx context.Context, owner, repo string, since UnleashVersion) ([]Release, error) {
+	releasesUrl := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=%d", c.apiUrl, owner, repo, tagsPerPage)
+	releases := []Release{}
+
+	for i := 0; releasesUrl != "" && i < maxTagPages; i++ {
+		var res []struct {
+			TagName     string    `json:"tag_name"`
+			Name        string    `json:"name"`
+			Body        string    `json:"body"`
+			HtmlUrl     string    `json:"html_url"`
+			PublishedAt time.Time `json:"published_at"`
+			Draft       bool      `json:"draft"`
+		}
+
+		next, err := c.getJSON(ctx, releasesUrl, &res)
+		if err != nil {
+			return nil, err
+		}
+		releasesUrl = next
+
+		for _, release := range res {
+			if version, err := tagToUnleashVersion(release.TagName); err == nil && !version.IsNewerThan(since) {
+				releasesUrl = ""
+			}
+
+			if release.Draft {
+				continue
+			}
+
+			releases = append(releases, Release{
+				Tag:         release.TagName,
+				Name:        release.Name,
+				Body:        release.Body,
+				Url:         release.HtmlUrl,
+				PublishedAt: release.PublishedAt,
+			})
+		}
+	}
+
+	return releases, nil
+}
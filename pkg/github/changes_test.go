@@ -0,0 +1,175 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestChangesServer(t *testing.T, comparePath *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/repos/%s/%s/releases", unleashRepoOwner, unleashRepoName):
+			_, err := w.Write([]byte(`[
+{"tag_name": "v5.9.0-20240201-090000-ccccccc", "name": "v5.9.0", "body": "Draft", "draft": true},
+{"tag_name": "v5.8.0-20240101-090000-bbbbbbb", "name": "v5.8.0", "body": "New features", "html_url": "https://github.com/nais/unleash/releases/v5.8.0"},
+{"tag_name": "v5.7.1-20231201-090000-aaaaaaa", "name": "v5.7.1", "body": "Bug fixes", "html_url": "https://github.com/nais/unleash/releases/v5.7.1"},
+{"tag_name": "v5.7.0-20231101-090000-9999999", "name": "v5.7.0", "body": "Old release"}
+]`))
+			assert.NoError(t, err)
+		default:
+			*comparePath = r.URL.Path
+			_, err := w.Write([]byte(`{
+"html_url": "https://github.com/nais/unleash/compare/a...b",
+"commits": [
+	{"sha": "1111111", "html_url": "https://github.com/nais/unleash/commit/1111111", "commit": {"message": "Fix bug\n\nLonger description", "author": {"name": "Alice", "date": "2023-11-15T09:00:00Z"}}},
+	{"sha": "2222222", "html_url": "https://github.com/nais/unleash/commit/2222222", "commit": {"message": "Add feature", "author": {"name": "Bob", "date": "2023-12-15T09:00:00Z"}}}
+]
+}`))
+			assert.NoError(t, err)
+		}
+	}))
+}
+
+func TestUnleashChanges(t *testing.T) {
+	var comparePath string
+	server := newTestChangesServer(t, &comparePath)
+	defer server.Close()
+
+	client := NewClient(server.URL, "", time.Minute, nil)
+
+	changes, err := client.UnleashChanges(context.Background(), "v5.7.0-20231101-090000-9999999", "v5.8.0-20240101-090000-bbbbbbb")
+	assert.NoError(t, err)
+	assert.Equal(t, "/repos/nais/unleash/compare/v5.7.0-20231101-090000-9999999...v5.8.0-20240101-090000-bbbbbbb", comparePath)
+	assert.False(t, changes.Downgrade)
+	assert.Equal(t, "https://github.com/nais/unleash/compare/a...b", changes.Url)
+
+	assert.Len(t, changes.Commits, 2)
+	assert.False(t, changes.Truncated)
+	assert.Equal(t, "2222222", changes.Commits[0].Sha)
+	assert.Equal(t, "Fix bug", changes.Commits[1].Message)
+	assert.Equal(t, "Alice", changes.Commits[1].Author)
+
+	assert.Len(t, changes.Releases, 2)
+	assert.Equal(t, "v5.8.0", changes.Releases[0].Name)
+	assert.Equal(t, "v5.7.1", changes.Releases[1].Name)
+}
+
+func TestUnleashChangesDowngrade(t *testing.T) {
+	var comparePath string
+	server := newTestChangesServer(t, &comparePath)
+	defer server.Close()
+
+	client := NewClient(server.URL, "", time.Minute, nil)
+
+	changes, err := client.UnleashChanges(context.Background(), "v5.8.0-20240101-090000-bbbbbbb", "v5.7.1-20231201-090000-aaaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, "/repos/nais/unleash/compare/v5.7.1-20231201-090000-aaaaaaa...v5.8.0-20240101-090000-bbbbbbb", comparePath)
+	assert.True(t, changes.Downgrade)
+	assert.Equal(t, "v5.8.0-20240101-090000-bbbbbbb", changes.Base)
+	assert.Equal(t, "v5.7.1-20231201-090000-aaaaaaa", changes.Head)
+
+	assert.Len(t, changes.Releases, 1)
+	assert.Equal(t, "v5.8.0", changes.Releases[0].Name)
+}
+
+func TestUnleashChangesInvalidTag(t *testing.T) {
+	client := NewClient("http://localhost", "", time.Minute, nil)
+
+	_, err := client.UnleashChanges(context.Background(), "latest", "v5.8.0-20240101-090000-bbbbbbb")
+	assert.Error(t, err)
+}
+
+func TestUnleashChangesReleasePagination(t *testing.T) {
+	pages := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/repos/%s/%s/releases", unleashRepoOwner, unleashRepoName) {
+			_, _ = w.Write([]byte(`{"commits": []}`))
+			return
+		}
+
+		pages++
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=100&page=2>; rel="next"`, server.URL, r.URL.Path))
+			_, _ = w.Write([]byte(`[{"tag_name": "v5.8.0-20240101-090000-bbbbbbb", "name": "v5.8.0"}]`))
+		case "2":
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=100&page=3>; rel="next"`, server.URL, r.URL.Path))
+			_, _ = w.Write([]byte(`[{"tag_name": "v5.7.1-20231201-090000-aaaaaaa", "name": "v5.7.1"}, {"tag_name": "v5.7.0-20231101-090000-9999999", "name": "v5.7.0"}]`))
+		default:
+			t.Errorf("unexpected request for page %s", r.URL.Query().Get("page"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", time.Minute, nil)
+
+	changes, err := client.UnleashChanges(context.Background(), "v5.7.0-20231101-090000-9999999", "v5.8.0-20240101-090000-bbbbbbb")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pages)
+
+	assert.Len(t, changes.Releases, 2)
+	assert.Equal(t, "v5.8.0", changes.Releases[0].Name)
+	assert.Equal(t, "v5.7.1", changes.Releases[1].Name)
+}
+
+func TestUnleashChangesCommitPagination(t *testing.T) {
+	pages := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == fmt.Sprintf("/repos/%s/%s/releases", unleashRepoOwner, unleashRepoName) {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+
+		pages++
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+		if page != fmt.Sprint(maxTagPages+1) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=100&page=%d>; rel="next"`, server.URL, r.URL.Path, pages+1))
+		}
+		_, _ = fmt.Fprintf(w, `{"html_url": "https://github.com/nais/unleash/compare/a...b", "commits": [{"sha": "%s-old"}, {"sha": "%s-new"}]}`, page, page)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", time.Minute, nil)
+
+	changes, err := client.UnleashChanges(context.Background(), "v5.7.0-20231101-090000-9999999", "v5.8.0-20240101-090000-bbbbbbb")
+	assert.NoError(t, err)
+	assert.Equal(t, maxTagPages, pages)
+	assert.True(t, changes.Truncated)
+	assert.Equal(t, "https://github.com/nais/unleash/compare/a...b", changes.Url)
+
+	assert.Len(t, changes.Commits, 2*maxTagPages)
+	assert.Equal(t, fmt.Sprintf("%d-new", maxTagPages), changes.Commits[0].Sha)
+	assert.Equal(t, "1-old", changes.Commits[len(changes.Commits)-1].Sha)
+}
+
+func TestResponseCacheIsBounded(t *testing.T) {
+	client := NewClient("http://localhost", "", time.Minute, nil)
+
+	client.storeResponse("first", cachedResponse{})
+	client.storeResponse("second", cachedResponse{})
+	for i := 0; i < maxCachedResponses-2; i++ {
+		client.storeResponse(fmt.Sprintf("url-%d", i), cachedResponse{})
+	}
+
+	// Using a response keeps it from being evicted
+	_, ok := client.cachedResponse("first")
+	assert.True(t, ok)
+
+	client.storeResponse("last", cachedResponse{})
+	assert.Len(t, client.responses, maxCachedResponses)
+	assert.Contains(t, client.responses, "first")
+	assert.NotContains(t, client.responses, "second")
+}
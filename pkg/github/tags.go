@@ -1,47 +1,292 @@
 package github
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultApiUrl = "https://api.github.com"
+
+	tagsPerPage = 100
+	maxTagPages = 10
+
+	// tagsRetryInterval is how long stale tags are served after a failed
+	// fetch before GitHub is tried again
+	tagsRetryInterval = time.Minute
+
+	// maxCachedResponses bounds the responses kept for revalidation, as every
+	// pair of compared versions adds a response
+	maxCachedResponses = 256
 )
 
 var (
-	githubApiUrl     = "https://api.github.com"
 	unleashRepoOwner = "nais"
 	unleashRepoName  = "unleash"
 )
 
-func getLatestTags(owner, repo string) ([]string, error) {
-	url := fmt.Sprintf("%s/repos/%s/%s/tags", githubApiUrl, owner, repo)
+// VersionProvider returns the Unleash versions that instances can run.
+type VersionProvider interface {
+	UnleashVersions(ctx context.Context) ([]UnleashVersion, error)
+}
+
+type cachedResponse struct {
+	etag string
+	body []byte
+	next string
+	used uint64
+}
+
+type cachedTags struct {
+	tags      []string
+	fetchedAt time.Time
+	retryAt   time.Time
+}
+
+// Client looks up tags in the GitHub REST API. Tags are cached in memory for
+// the configured TTL and pages are revalidated with their ETag, so unchanged
+// pages do not count against the rate limit. When GitHub cannot be reached or
+// the rate limit is exhausted, the last successful result is returned.
+// Concurrent lookups of the same repository share a single fetch.
+type Client struct {
+	apiUrl     string
+	token      string
+	ttl        time.Duration
+	httpClient *http.Client
+	now        func() time.Time
+	fetches    singleflight.Group
+
+	mu               sync.Mutex
+	tags             map[string]cachedTags
+	responses        map[string]cachedResponse
+	responseUses     uint64
+	rateLimitedUntil time.Time
+}
+
+func NewClient(apiUrl, token string, ttl time.Duration, httpClient *http.Client) *Client {
+	if apiUrl == "" {
+		apiUrl = DefaultApiUrl
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		apiUrl:     strings.TrimSuffix(apiUrl, "/"),
+		token:      token,
+		ttl:        ttl,
+		httpClient: httpClient,
+		now:        time.Now,
+		tags:       map[string]cachedTags{},
+		responses:  map[string]cachedResponse{},
+	}
+}
+
+// Tags returns the names of the repository's tags in the order GitHub lists
+// them.
+func (c *Client) Tags(ctx context.Context, owner, repo string) ([]string, error) {
+	key := owner + "/" + repo
+	now := c.now()
+
+	c.mu.Lock()
+	cached, ok := c.tags[key]
+	rateLimitedUntil := c.rateLimitedUntil
+	c.mu.Unlock()
 
-	resp, err := http.Get(url)
+	if ok && (now.Sub(cached.fetchedAt) < c.ttl || now.Before(cached.retryAt)) {
+		return cached.tags, nil
+	}
+
+	if now.Before(rateLimitedUntil) {
+		if ok {
+			return cached.tags, nil
+		}
+		return nil, fmt.Errorf("github rate limit exceeded until %s", rateLimitedUntil.Format(time.RFC3339))
+	}
+
+	tags, err, _ := c.fetches.Do(key, func() (interface{}, error) {
+		// The fetch is shared, so it must not be cancelled with the request
+		// that started it
+		tags, err := c.fetchTags(context.WithoutCancel(ctx), owner, repo)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if err != nil {
+			// Serve the stale tags for a while instead of retrying on
+			// every request
+			if ok {
+				cached.retryAt = now.Add(tagsRetryInterval)
+				c.tags[key] = cached
+			}
+			return nil, err
+		}
+
+		c.tags[key] = cachedTags{tags: tags, fetchedAt: now}
+		return tags, nil
+	})
 	if err != nil {
+		if ok {
+			return cached.tags, nil
+		}
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	return tags.([]string), nil
+}
+
+func (c *Client) fetchTags(ctx context.Context, owner, repo string) ([]string, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/tags?per_page=%d", c.apiUrl, owner, repo, tagsPerPage)
+	tags := []string{}
+
+	for i := 0; url != "" && i < maxTagPages; i++ {
+		resp, err := c.fetch(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(resp.body, &page); err != nil {
+			return nil, err
+		}
+
+		for _, tag := range page {
+			tags = append(tags, tag.Name)
+		}
+		url = resp.next
+	}
+
+	return tags, nil
+}
+
+// fetch gets url from the GitHub API. Responses are cached with their ETag and
+// revalidated with a conditional request. The lock is only held to read and
+// write the cache, not during the request.
+func (c *Client) fetch(ctx context.Context, url string) (cachedResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return cachedResponse{}, err
 	}
+	req.Header.Set("Accept", "application/vnd.github+json")
 
-	var tags []struct {
-		Name string `json:"name"`
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
-	err = json.NewDecoder(resp.Body).Decode(&tags)
+
+	cached, ok := c.cachedResponse(url)
+	if ok && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return cachedResponse{}, err
 	}
+	defer resp.Body.Close()
 
-	var tagNames []string
-	for _, tag := range tags {
-		tagNames = append(tagNames, tag.Name)
+	c.mu.Lock()
+	c.updateRateLimit(resp)
+	c.mu.Unlock()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && ok:
+		return cached, nil
+	case resp.StatusCode != http.StatusOK:
+		return cachedResponse{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	return tagNames, nil
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return cachedResponse{}, err
+	}
+
+	response := cachedResponse{
+		etag: resp.Header.Get("ETag"),
+		body: body,
+		next: nextPageUrl(resp.Header.Get("Link")),
+	}
+
+	c.storeResponse(url, response)
+
+	return response, nil
+}
+
+// cachedResponse returns the cached response for url and marks it as used.
+func (c *Client) cachedResponse(url string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	response, ok := c.responses[url]
+	if ok {
+		c.responseUses++
+		response.used = c.responseUses
+		c.responses[url] = response
+	}
+
+	return response, ok
+}
+
+// storeResponse caches the response for url, evicting the least recently used
+// responses when the cache is full.
+func (c *Client) storeResponse(url string, response cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.responseUses++
+	response.used = c.responseUses
+	c.responses[url] = response
+
+	for len(c.responses) > maxCachedResponses {
+		oldest := ""
+		for key, cached := range c.responses {
+			if oldest == "" || cached.used < c.responses[oldest].used {
+				oldest = key
+			}
+		}
+		delete(c.responses, oldest)
+	}
+}
+
+// updateRateLimit stops requests to GitHub until the rate limit resets once it
+// has been exhausted, or for as long as a secondary rate limit asks us to. It
+// must be called with c.mu held.
+func (c *Client) updateRateLimit(resp *http.Response) {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		c.rateLimitedUntil = c.now().Add(time.Duration(seconds) * time.Second)
+		return
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		c.rateLimitedUntil = time.Unix(reset, 0)
+	}
+}
+
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+func nextPageUrl(link string) string {
+	match := linkNextPattern.FindStringSubmatch(link)
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
 }
 
 func tagToUnleashVersion(tag string) (UnleashVersion, error) {
@@ -57,6 +302,11 @@ func tagToUnleashVersion(tag string) (UnleashVersion, error) {
 	versionComponents := strings.Split(tagComponents[0], "v")
 	versionNumber := versionComponents[1]
 
+	semver, err := ParseSemver(versionNumber)
+	if err != nil {
+		return UnleashVersion{}, err
+	}
+
 	// Parse the release date and time
 	releaseDateTime, err := time.Parse("20060102-150405", fmt.Sprintf("%s-%s", tagComponents[1], tagComponents[2]))
 	if err != nil {
@@ -68,6 +318,7 @@ func tagToUnleashVersion(tag string) (UnleashVersion, error) {
 
 	return UnleashVersion{
 		VersionNumber: versionNumber,
+		Semver:        semver,
 		ReleaseTime:   releaseDateTime,
 		CommitHash:    commitHash,
 		GitTag:        tag,
@@ -76,17 +327,26 @@ func tagToUnleashVersion(tag string) (UnleashVersion, error) {
 
 type UnleashVersion struct {
 	VersionNumber string
+	Semver        Semver
 	ReleaseTime   time.Time
 	CommitHash    string
 	GitTag        string
 }
 
-func UnleashVersions() ([]UnleashVersion, error) {
-	tags, err := getLatestTags(unleashRepoOwner, unleashRepoName)
+// UnleashVersions returns the versions of nais/unleash tags that follow the
+// image tag format, newest first. Other tags are ignored.
+func (c *Client) UnleashVersions(ctx context.Context) ([]UnleashVersion, error) {
+	tags, err := c.Tags(ctx, unleashRepoOwner, unleashRepoName)
 	if err != nil {
 		return nil, err
 	}
 
+	return UnleashVersionsFromTags(tags), nil
+}
+
+// UnleashVersionsFromTags parses the tags that follow the image tag format,
+// newest first. Other tags are ignored.
+func UnleashVersionsFromTags(tags []string) []UnleashVersion {
 	versions := []UnleashVersion{}
 
 	for _, tag := range tags {
@@ -96,5 +356,7 @@ func UnleashVersions() ([]UnleashVersion, error) {
 		}
 	}
 
-	return versions, nil
+	SortUnleashVersions(versions)
+
+	return versions
 }
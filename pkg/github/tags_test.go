@@ -1,9 +1,12 @@
 package github
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -52,9 +55,9 @@ func TestUnleashVersions(t *testing.T) {
 	}))
 	defer server.Close()
 
-	githubApiUrl = server.URL
+	client := NewClient(server.URL, "", time.Minute, nil)
 
-	versions, err := UnleashVersions()
+	versions, err := client.UnleashVersions(context.Background())
 	assert.NoError(t, err)
 	assert.NotEmpty(t, versions)
 
@@ -76,6 +79,7 @@ func TestTagToUnleashVersion(t *testing.T) {
 			tag: "v1.0.0-20220101-010101-abcdefg",
 			expected: UnleashVersion{
 				VersionNumber: "1.0.0",
+				Semver:        Semver{Major: 1, Minor: 0, Patch: 0},
 				ReleaseTime:   time.Date(2022, 0o1, 0o1, 0o1, 0o1, 0o1, 0, time.UTC),
 				CommitHash:    "abcdefg",
 				GitTag:        "v1.0.0-20220101-010101-abcdefg",
@@ -128,7 +132,7 @@ func TestTagToUnleashVersion(t *testing.T) {
 	}
 }
 
-func TestGetLatestTags(t *testing.T) {
+func TestTags(t *testing.T) {
 	testCases := []struct {
 		name     string
 		owner    string
@@ -175,9 +179,9 @@ func TestGetLatestTags(t *testing.T) {
 			}))
 			defer server.Close()
 
-			githubApiUrl = server.URL
+			client := NewClient(server.URL, "", time.Minute, nil)
 
-			got, err := getLatestTags(tc.owner, tc.repo)
+			got, err := client.Tags(context.Background(), tc.owner, tc.repo)
 
 			if tc.wantErr {
 				assert.Error(t, err)
@@ -189,3 +193,209 @@ func TestGetLatestTags(t *testing.T) {
 		})
 	}
 }
+
+func TestTagsPagination(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer my-token", r.Header.Get("Authorization"))
+
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/test/test/tags?per_page=100&page=2>; rel="next", <%s/repos/test/test/tags?per_page=100&page=2>; rel="last"`, server.URL, server.URL))
+			_, _ = w.Write([]byte(`[{"name": "v1.2.0"}, {"name": "v1.1.0"}]`))
+		case "2":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/test/test/tags?per_page=100&page=1>; rel="first"`, server.URL))
+			_, _ = w.Write([]byte(`[{"name": "v1.0.0"}]`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "my-token", time.Minute, nil)
+
+	got, err := client.Tags(context.Background(), "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.2.0", "v1.1.0", "v1.0.0"}, got)
+}
+
+func TestTagsCache(t *testing.T) {
+	requests, notModified := 0, 0
+	tags := `[{"name": "v1.0.0"}]`
+	fail := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		etag := fmt.Sprintf(`"%d"`, len(tags))
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(tags))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", time.Minute, nil)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	got, err := client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, got)
+
+	// Cached within the TTL.
+	_, _ = client.Tags(ctx, "test", "test")
+	assert.Equal(t, 1, requests)
+
+	// Revalidated with the ETag after the TTL.
+	now = now.Add(2 * time.Minute)
+	got, err = client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, got)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, notModified)
+
+	// Changed tags are fetched.
+	now = now.Add(2 * time.Minute)
+	tags = `[{"name": "v1.1.0"}, {"name": "v1.0.0"}]`
+	got, err = client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.1.0", "v1.0.0"}, got)
+
+	// Stale tags are returned when GitHub fails.
+	now = now.Add(2 * time.Minute)
+	fail = true
+	got, err = client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.1.0", "v1.0.0"}, got)
+	assert.Equal(t, 4, requests)
+
+	// GitHub is not retried on every request after a failure.
+	now = now.Add(30 * time.Second)
+	got, err = client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.1.0", "v1.0.0"}, got)
+	assert.Equal(t, 4, requests)
+
+	now = now.Add(time.Minute)
+	fail = false
+	_, err = client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, requests)
+}
+
+func TestTagsRateLimit(t *testing.T) {
+	requests := 0
+	reset := time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", reset.Unix()))
+		_, _ = w.Write([]byte(`[{"name": "v1.0.0"}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", time.Minute, nil)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+
+	// The cached tags are returned until the rate limit resets.
+	now = now.Add(30 * time.Minute)
+	got, err := client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, got)
+	assert.Equal(t, 1, requests)
+
+	_, err = client.Tags(ctx, "other", "repo")
+	assert.EqualError(t, err, "github rate limit exceeded until 2024-01-01T13:00:00Z")
+	assert.Equal(t, 1, requests)
+
+	now = now.Add(31 * time.Minute)
+	_, err = client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestTagsDoNotWaitForOtherFetches(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/test/slow/tags" {
+			close(started)
+			<-release
+		}
+		_, _ = w.Write([]byte(`[{"name": "v1.0.0"}]`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, "", time.Minute, nil)
+	ctx := context.Background()
+
+	_, err := client.Tags(ctx, "test", "test")
+	assert.NoError(t, err)
+
+	go func() { _, _ = client.Tags(ctx, "test", "slow") }()
+	<-started
+
+	// Cached tags are returned while another repository is being fetched
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		got, err := client.Tags(ctx, "test", "test")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"v1.0.0"}, got)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cached tags waited for another fetch")
+	}
+}
+
+func TestTagsShareConcurrentFetches(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_, _ = w.Write([]byte(`[{"name": "v1.0.0"}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", time.Minute, nil)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := client.Tags(ctx, "test", "test")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"v1.0.0"}, got)
+		}()
+	}
+
+	assert.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -0,0 +1,162 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Semver is a semantic version without pre-release or build metadata, which
+// Unleash releases do not use.
+type Semver struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseSemver parses versions such as "5.10.2" or "v5.10.2".
+func ParseSemver(version string) (Semver, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return Semver{}, fmt.Errorf("invalid semantic version: %s", version)
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Semver{}, fmt.Errorf("invalid semantic version: %s", version)
+		}
+		numbers[i] = n
+	}
+
+	return Semver{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+func (s Semver) String() string {
+	return fmt.Sprintf("%d.%d.%d", s.Major, s.Minor, s.Patch)
+}
+
+// Compare returns -1, 0 or 1 if s is older than, equal to or newer than other.
+func (s Semver) Compare(other Semver) int {
+	for _, d := range []int{s.Major - other.Major, s.Minor - other.Minor, s.Patch - other.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// IsNewerThan reports whether v is a newer release than other. Builds of the
+// same version are ordered by release time.
+func (v UnleashVersion) IsNewerThan(other UnleashVersion) bool {
+	if c := v.Semver.Compare(other.Semver); c != 0 {
+		return c > 0
+	}
+
+	return v.ReleaseTime.After(other.ReleaseTime)
+}
+
+// SortUnleashVersions sorts versions newest first.
+func SortUnleashVersions(versions []UnleashVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].IsNewerThan(versions[j])
+	})
+}
+
+// LatestUnleashVersion returns the newest of versions.
+func LatestUnleashVersion(versions []UnleashVersion) (UnleashVersion, bool) {
+	var latest UnleashVersion
+	found := false
+
+	for _, v := range versions {
+		if !found || v.IsNewerThan(latest) {
+			latest = v
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+// LatestPatch returns the newest of versions with the same major and minor
+// version as current.
+func LatestPatch(versions []UnleashVersion, current Semver) (UnleashVersion, bool) {
+	sameMinor := []UnleashVersion{}
+	for _, v := range versions {
+		if v.Semver.Major == current.Major && v.Semver.Minor == current.Minor {
+			sameMinor = append(sameMinor, v)
+		}
+	}
+
+	return LatestUnleashVersion(sameMinor)
+}
+
+// UnleashVersionGroup is a set of versions sharing a major and minor version.
+type UnleashVersionGroup struct {
+	Name     string
+	Versions []UnleashVersion
+}
+
+// GroupUnleashVersions groups versions by major and minor version, newest
+// first.
+func GroupUnleashVersions(versions []UnleashVersion) []UnleashVersionGroup {
+	sorted := make([]UnleashVersion, len(versions))
+	copy(sorted, versions)
+	SortUnleashVersions(sorted)
+
+	groups := []UnleashVersionGroup{}
+	for _, v := range sorted {
+		name := fmt.Sprintf("v%d.%d", v.Semver.Major, v.Semver.Minor)
+		if len(groups) == 0 || groups[len(groups)-1].Name != name {
+			groups = append(groups, UnleashVersionGroup{Name: name})
+		}
+
+		groups[len(groups)-1].Versions = append(groups[len(groups)-1].Versions, v)
+	}
+
+	return groups
+}
+
+type intersectVersionProvider struct {
+	primary VersionProvider
+	other   VersionProvider
+}
+
+// IntersectVersionProviders returns a VersionProvider listing the versions of
+// primary that other also lists.
+func IntersectVersionProviders(primary, other VersionProvider) VersionProvider {
+	return &intersectVersionProvider{primary: primary, other: other}
+}
+
+func (p *intersectVersionProvider) UnleashVersions(ctx context.Context) ([]UnleashVersion, error) {
+	versions, err := p.primary.UnleashVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	otherVersions, err := p.other.UnleashVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]bool{}
+	for _, v := range otherVersions {
+		tags[v.GitTag] = true
+	}
+
+	intersection := []UnleashVersion{}
+	for _, v := range versions {
+		if tags[v.GitTag] {
+			intersection = append(intersection, v)
+		}
+	}
+
+	return intersection, nil
+}
@@ -0,0 +1,146 @@
+package github
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVersion(t *testing.T, tag string) UnleashVersion {
+	v, err := tagToUnleashVersion(tag)
+	assert.NoError(t, err)
+	return v
+}
+
+func TestParseSemver(t *testing.T) {
+	testCases := []struct {
+		version string
+		want    Semver
+		wantErr bool
+	}{
+		{version: "5.10.2", want: Semver{5, 10, 2}},
+		{version: "v4.23.0", want: Semver{4, 23, 0}},
+		{version: "5.10", wantErr: true},
+		{version: "5.x.2", wantErr: true},
+		{version: "", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			got, err := ParseSemver(tc.version)
+			if tc.wantErr {
+				assert.EqualError(t, err, "invalid semantic version: "+tc.version)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	assert.Equal(t, 0, Semver{5, 10, 2}.Compare(Semver{5, 10, 2}))
+	assert.Equal(t, 1, Semver{5, 10, 2}.Compare(Semver{5, 9, 12}))
+	assert.Equal(t, -1, Semver{4, 23, 0}.Compare(Semver{5, 0, 0}))
+	assert.Equal(t, -1, Semver{5, 10, 1}.Compare(Semver{5, 10, 2}))
+}
+
+func TestSortUnleashVersions(t *testing.T) {
+	versions := []UnleashVersion{
+		newTestVersion(t, "v5.9.12-20240101-000000-aaaaaaa"),
+		newTestVersion(t, "v5.10.2-20240301-000000-bbbbbbb"),
+		newTestVersion(t, "v5.10.2-20240329-000000-ccccccc"),
+		newTestVersion(t, "v4.23.4-20230804-081623-e0123bf"),
+		newTestVersion(t, "v5.10.10-20240201-000000-ddddddd"),
+	}
+
+	SortUnleashVersions(versions)
+
+	tags := []string{}
+	for _, v := range versions {
+		tags = append(tags, v.GitTag)
+	}
+
+	assert.Equal(t, []string{
+		"v5.10.10-20240201-000000-ddddddd",
+		"v5.10.2-20240329-000000-ccccccc",
+		"v5.10.2-20240301-000000-bbbbbbb",
+		"v5.9.12-20240101-000000-aaaaaaa",
+		"v4.23.4-20230804-081623-e0123bf",
+	}, tags)
+}
+
+func TestIsNewerThan(t *testing.T) {
+	older := newTestVersion(t, "v5.10.2-20240301-000000-bbbbbbb")
+	rebuild := newTestVersion(t, "v5.10.2-20240329-000000-ccccccc")
+	newer := newTestVersion(t, "v5.11.0-20240101-000000-ddddddd")
+
+	assert.True(t, rebuild.IsNewerThan(older))
+	assert.True(t, newer.IsNewerThan(rebuild))
+	assert.False(t, older.IsNewerThan(newer))
+	assert.False(t, older.IsNewerThan(older))
+}
+
+func TestLatestPatch(t *testing.T) {
+	versions := []UnleashVersion{
+		newTestVersion(t, "v5.11.0-20240401-000000-aaaaaaa"),
+		newTestVersion(t, "v5.10.3-20240329-000000-bbbbbbb"),
+		newTestVersion(t, "v5.10.1-20240301-000000-ccccccc"),
+	}
+
+	latest, ok := LatestPatch(versions, Semver{5, 10, 1})
+	assert.True(t, ok)
+	assert.Equal(t, "v5.10.3-20240329-000000-bbbbbbb", latest.GitTag)
+
+	_, ok = LatestPatch(versions, Semver{4, 23, 0})
+	assert.False(t, ok)
+
+	latest, ok = LatestUnleashVersion(versions)
+	assert.True(t, ok)
+	assert.Equal(t, "v5.11.0-20240401-000000-aaaaaaa", latest.GitTag)
+
+	_, ok = LatestUnleashVersion(nil)
+	assert.False(t, ok)
+}
+
+func TestGroupUnleashVersions(t *testing.T) {
+	versions := []UnleashVersion{
+		newTestVersion(t, "v5.10.1-20240301-000000-ccccccc"),
+		newTestVersion(t, "v5.11.0-20240401-000000-aaaaaaa"),
+		newTestVersion(t, "v5.10.3-20240329-000000-bbbbbbb"),
+	}
+
+	groups := GroupUnleashVersions(versions)
+
+	assert.Len(t, groups, 2)
+	assert.Equal(t, "v5.11", groups[0].Name)
+	assert.Len(t, groups[0].Versions, 1)
+	assert.Equal(t, "v5.10", groups[1].Name)
+	assert.Equal(t, "v5.10.3-20240329-000000-bbbbbbb", groups[1].Versions[0].GitTag)
+	assert.Equal(t, "v5.10.1-20240301-000000-ccccccc", groups[1].Versions[1].GitTag)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), groups[1].Versions[1].ReleaseTime)
+}
+
+type staticVersionProvider []UnleashVersion
+
+func (p staticVersionProvider) UnleashVersions(ctx context.Context) ([]UnleashVersion, error) {
+	return p, nil
+}
+
+func TestIntersectVersionProviders(t *testing.T) {
+	released := staticVersionProvider{
+		newTestVersion(t, "v5.11.0-20240401-000000-aaaaaaa"),
+		newTestVersion(t, "v5.10.3-20240329-000000-bbbbbbb"),
+	}
+	pushed := staticVersionProvider{
+		newTestVersion(t, "v5.10.3-20240329-000000-bbbbbbb"),
+		newTestVersion(t, "v5.10.1-20240301-000000-ccccccc"),
+	}
+
+	versions, err := IntersectVersionProviders(released, pushed).UnleashVersions(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1)
+	assert.Equal(t, "v5.10.3-20240329-000000-bbbbbbb", versions[0].GitTag)
+}
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/unleash"
+	"github.com/nais/bifrost/pkg/utils"
+)
+
+// UnleashInstanceResponse is the JSON representation of an Unleash instance
+// returned by the /api/v1 endpoints. Config fields use the same names as in
+// the request body.
+type UnleashInstanceResponse struct {
+	Name                      string              `json:"name"`
+	Namespace                 string              `json:"namespace"`
+	CreatedAt                 time.Time           `json:"created-at"`
+	Status                    unleash.Status      `json:"status"`
+	Ready                     bool                `json:"ready"`
+	Conditions                []unleash.Condition `json:"conditions"`
+	Version                   string              `json:"version"`
+	WebUrl                    string              `json:"web-url"`
+	ApiUrl                    string              `json:"api-url"`
+	CustomVersion             string              `json:"custom-version"`
+	UpgradeChannel            string              `json:"upgrade-channel"`
+	EnableFederation          bool                `json:"enable-federation"`
+	AllowedTeams              string              `json:"allowed-teams"`
+	AllowedNamespaces         string              `json:"allowed-namespaces"`
+	AllowedClusters           string              `json:"allowed-clusters"`
+	LogLevel                  string              `json:"log-level"`
+	DatabasePoolMax           int                 `json:"database-pool-max"`
+	DatabasePoolIdleTimeoutMs int                 `json:"database-pool-idle-timeout-ms"`
+}
+
+type UnleashInstanceListResponse struct {
+	Instances []UnleashInstanceResponse `json:"instances"`
+}
+
+type UnleashInstanceEventsResponse struct {
+	Name   string                  `json:"name"`
+	Events []unleash.InstanceEvent `json:"events"`
+}
+
+type ErrorResponse struct {
+	Error           string `json:"error"`
+	ValidationError string `json:"validationError,omitempty"`
+}
+
+func NewUnleashInstanceResponse(instance *unleash.UnleashInstance) UnleashInstanceResponse {
+	res := UnleashInstanceResponse{
+		Name:       instance.Name,
+		Namespace:  instance.KubernetesNamespace,
+		CreatedAt:  instance.CreatedAt.Time,
+		Status:     instance.Status(),
+		Ready:      instance.IsReady(),
+		Conditions: instance.Conditions(),
+		Version:    instance.Version(),
+		WebUrl:     instance.WebUrl(),
+		ApiUrl:     instance.ApiUrl(),
+	}
+
+	if instance.ServerInstance != nil {
+		uc := unleash.UnleashVariables(instance.ServerInstance, false)
+		res.CustomVersion = uc.CustomVersion
+		res.UpgradeChannel = uc.UpgradeChannel
+		res.EnableFederation = uc.EnableFederation
+		res.AllowedTeams = uc.AllowedTeams
+		res.AllowedNamespaces = uc.AllowedNamespaces
+		res.AllowedClusters = uc.AllowedClusters
+		res.LogLevel = uc.LogLevel
+		res.DatabasePoolMax = uc.DatabasePoolMax
+		res.DatabasePoolIdleTimeoutMs = uc.DatabasePoolIdleTimeoutMs
+	}
+
+	return res
+}
+
+func (h *Handler) apiError(c *gin.Context, code int, err error, message string) {
+	h.log(c).WithError(err).Error(message)
+	c.AbortWithStatusJSON(code, ErrorResponse{Error: message})
+}
+
+func (h *Handler) apiPersistError(c *gin.Context, err error, action string) {
+	var (
+		validationErr *unleash.ValidationError
+		provisionErr  *unleash.ProvisionError
+		unleashErr    *unleash.UnleashError
+	)
+
+	if errors.As(err, &validationErr) {
+		h.apiValidationError(c, validationErr)
+		return
+	}
+
+	code := 500
+	if unleash.IsAlreadyExists(err) {
+		code = 409
+	}
+
+	message := fmt.Sprintf("Error %s Unleash instance", action)
+	if errors.As(err, &provisionErr) {
+		message = fmt.Sprintf("%s, %s", message, provisionErr.Error())
+	} else if errors.As(err, &unleashErr) {
+		message = fmt.Sprintf("%s, %s", message, unleashErr.Reason)
+	}
+
+	h.apiError(c, code, err, message)
+}
+
+func (h *Handler) apiValidationError(c *gin.Context, err error) {
+	h.log(c).WithError(err).Info("Error validating Unleash config")
+	c.AbortWithStatusJSON(400, ErrorResponse{
+		Error:           "Input validation failed, see errors in details",
+		ValidationError: err.Error(),
+	})
+}
+
+// apiAuthorizeTeams aborts with 403 Forbidden if the user adds or removes
+// teams they are not allowed to assign, or creates an instance none of their
+// teams can access, and reports whether the request may continue.
+func (h *Handler) apiAuthorizeTeams(c *gin.Context, current []string, allowedTeams string, create bool) bool {
+	validationErr, err := h.teamAssignmentError(c, current, allowedTeams, create)
+	if err != nil {
+		h.apiError(c, accessErrorStatus(err), err, "Error checking access to teams")
+		return false
+	}
+
+	if validationErr != nil {
+		c.AbortWithStatusJSON(403, ErrorResponse{
+			Error:           "Not allowed to assign these teams",
+			ValidationError: validationErr.Error(),
+		})
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) UnleashApiInstanceMiddleware(c *gin.Context) {
+	name := c.Param("name")
+	ctx := c.Request.Context()
+
+	instance, err := h.unleashService.Get(ctx, name)
+	if err != nil {
+		if unleash.IsNotFound(err) {
+			c.AbortWithStatusJSON(404, ErrorResponse{Error: fmt.Sprintf("Unleash instance %s not found", name)})
+			return
+		}
+
+		h.apiError(c, 500, err, "Error getting Unleash instance")
+		return
+	}
+
+	allowed, err := h.canAccessInstance(c, instance)
+	if err != nil {
+		h.apiError(c, accessErrorStatus(err), err, "Error checking access to Unleash instance")
+		return
+	}
+
+	if !allowed {
+		c.AbortWithStatusJSON(403, ErrorResponse{Error: fmt.Sprintf("Not allowed to access Unleash instance %s", name)})
+		return
+	}
+
+	h.setInstance(c, instance)
+	c.Next()
+}
+
+func (h *Handler) UnleashApiList(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	instances, err := h.unleashService.List(ctx)
+	if err != nil {
+		h.apiError(c, 500, err, "Error getting Unleash instances")
+		return
+	}
+
+	instances, err = h.accessibleInstances(c, instances)
+	if err != nil {
+		h.apiError(c, accessErrorStatus(err), err, "Error checking access to Unleash instances")
+		return
+	}
+
+	res := UnleashInstanceListResponse{Instances: []UnleashInstanceResponse{}}
+	for _, instance := range instances {
+		res.Instances = append(res.Instances, NewUnleashInstanceResponse(instance))
+	}
+
+	c.JSON(200, res)
+}
+
+func (h *Handler) UnleashApiGet(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	c.JSON(200, NewUnleashInstanceResponse(instance))
+}
+
+func (h *Handler) UnleashApiCreate(c *gin.Context) {
+	ctx := c.Request.Context()
+	uc := &unleash.UnleashConfig{}
+
+	if err := c.ShouldBindJSON(uc); err != nil {
+		h.apiValidationError(c, err)
+		return
+	}
+
+	unleashVersions := h.unleashVersions(ctx)
+
+	uc.FederationNonce = utils.RandomString(8)
+	uc.SetDefaultValues(unleashVersions)
+	uc.MergeTeamsAndNamespaces()
+
+	if err := uc.Validate(h.existingTeams(ctx, nil)); err != nil {
+		h.apiValidationError(c, err)
+		return
+	}
+
+	if !h.apiAuthorizeTeams(c, nil, uc.AllowedTeams, true) {
+		return
+	}
+
+	if _, err := h.unleashService.Get(ctx, uc.Name); err == nil {
+		c.AbortWithStatusJSON(409, ErrorResponse{Error: fmt.Sprintf("Unleash instance %s already exists", uc.Name)})
+		return
+	} else if !unleash.IsNotFound(err) {
+		h.apiError(c, 500, err, "Error getting Unleash instance")
+		return
+	}
+
+	server, err := h.unleashService.Create(ctx, uc)
+	if err != nil {
+		h.apiPersistError(c, err, "creating")
+		return
+	}
+
+	c.JSON(201, NewUnleashInstanceResponse(unleash.NewUnleashInstance(server)))
+}
+
+// UnleashApiUpdate updates an existing instance. Fields omitted from the
+// request body keep their current value.
+func (h *Handler) UnleashApiUpdate(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+	ctx := c.Request.Context()
+
+	uc := unleash.UnleashVariables(instance.ServerInstance, true)
+
+	if err := c.ShouldBindJSON(uc); err != nil {
+		h.apiValidationError(c, err)
+		return
+	}
+
+	uc.Name = instance.ServerInstance.GetName()
+	uc.FederationNonce = instance.ServerInstance.Spec.Federation.SecretNonce
+	uc.MergeTeamsAndNamespaces()
+
+	currentTeams := assignedTeams(instance)
+
+	if err := uc.Validate(h.existingTeams(ctx, currentTeams)); err != nil {
+		h.apiValidationError(c, err)
+		return
+	}
+
+	if !h.apiAuthorizeTeams(c, currentTeams, uc.AllowedTeams, false) {
+		return
+	}
+
+	server, err := h.unleashService.Update(ctx, uc)
+	if err != nil {
+		h.apiPersistError(c, err, "updating")
+		return
+	}
+
+	c.JSON(200, NewUnleashInstanceResponse(unleash.NewUnleashInstance(server)))
+}
+
+func (h *Handler) UnleashApiDelete(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+	ctx := c.Request.Context()
+
+	if err := h.unleashService.Delete(ctx, instance.Name); err != nil {
+		h.apiPersistError(c, err, "deleting")
+		return
+	}
+
+	c.Status(204)
+}
+
+func (h *Handler) UnleashApiEvents(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	events, err := h.unleashService.Events(c.Request.Context(), instance.Name)
+	if err != nil {
+		h.apiError(c, 500, err, "Error getting events for Unleash instance")
+		return
+	}
+
+	c.JSON(200, UnleashInstanceEventsResponse{Name: instance.Name, Events: events})
+}
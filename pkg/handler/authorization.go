@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/iap"
+	"github.com/nais/bifrost/pkg/teams"
+	"github.com/nais/bifrost/pkg/unleash"
+	"github.com/nais/bifrost/pkg/utils"
+)
+
+var errNotAuthenticated = errors.New("no authenticated user in request")
+
+// userAccess resolves the access of the authenticated user once per request.
+// When authorization is disabled every user is treated as a platform admin.
+func (h *Handler) userAccess(c *gin.Context) (*teams.Access, error) {
+	if h.authorizer == nil {
+		return &teams.Access{Admin: true}, nil
+	}
+
+	if access, exists := c.Get("access"); exists {
+		return access.(*teams.Access), nil
+	}
+
+	user, ok := iap.UserFromContext(c.Request.Context())
+	if !ok {
+		return nil, errNotAuthenticated
+	}
+
+	access, err := h.authorizer.Access(c.Request.Context(), user)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set("access", access)
+
+	return access, nil
+}
+
+// accessErrorStatus returns the HTTP status code for an error resolving the
+// user's access.
+func accessErrorStatus(err error) int {
+	if errors.Is(err, errNotAuthenticated) {
+		return 401
+	}
+
+	return 500
+}
+
+func instanceTeams(instance *unleash.UnleashInstance) []string {
+	if instance.ServerInstance == nil {
+		return []string{}
+	}
+
+	uc := unleash.UnleashVariables(instance.ServerInstance, false)
+	return utils.SplitNoEmpty(uc.AllowedTeams, ",")
+}
+
+// assignedTeams returns the teams of the instance as they are submitted when
+// the instance is edited, with the namespaces merged into the teams.
+func assignedTeams(instance *unleash.UnleashInstance) []string {
+	if instance.ServerInstance == nil {
+		return []string{}
+	}
+
+	uc := unleash.UnleashVariables(instance.ServerInstance, true)
+	uc.MergeTeamsAndNamespaces()
+	return utils.SplitNoEmpty(uc.AllowedTeams, ",")
+}
+
+func (h *Handler) canAccessInstance(c *gin.Context, instance *unleash.UnleashInstance) (bool, error) {
+	access, err := h.userAccess(c)
+	if err != nil {
+		return false, err
+	}
+
+	return access.CanAccess(instanceTeams(instance)), nil
+}
+
+func (h *Handler) accessibleInstances(c *gin.Context, instances []*unleash.UnleashInstance) ([]*unleash.UnleashInstance, error) {
+	access, err := h.userAccess(c)
+	if err != nil {
+		return nil, err
+	}
+
+	accessible := []*unleash.UnleashInstance{}
+	for _, instance := range instances {
+		if access.CanAccess(instanceTeams(instance)) {
+			accessible = append(accessible, instance)
+		}
+	}
+
+	return accessible, nil
+}
+
+// unassignableTeams returns the teams the user adds to or removes from the
+// current teams of an instance without being allowed to assign them, so users
+// can not grant or revoke access for teams they are not a member of.
+func (h *Handler) unassignableTeams(c *gin.Context, current []string, allowedTeams string) ([]string, error) {
+	access, err := h.userAccess(c)
+	if err != nil {
+		return nil, err
+	}
+
+	submitted := utils.SplitNoEmpty(allowedTeams, ",")
+	denied := []string{}
+
+	for _, team := range submitted {
+		if !slices.Contains(current, team) && !access.CanAssign(team) {
+			denied = append(denied, team)
+		}
+	}
+
+	for _, team := range current {
+		if !slices.Contains(submitted, team) && !access.CanAssign(team) {
+			denied = append(denied, team)
+		}
+	}
+
+	return denied, nil
+}
+
+// teamAssignmentError returns a validation error if the user adds or removes
+// teams they are not allowed to assign, or creates an instance none of their
+// teams can access, which would lock them out of it.
+func (h *Handler) teamAssignmentError(c *gin.Context, current []string, allowedTeams string, create bool) (*unleash.ValidationError, error) {
+	denied, err := h.unassignableTeams(c, current, allowedTeams)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(denied) > 0 {
+		return unassignableTeamsError(denied), nil
+	}
+
+	access, err := h.userAccess(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if create && !access.CanAccess(utils.SplitNoEmpty(allowedTeams, ",")) {
+		return &unleash.ValidationError{
+			Field:  "AllowedTeams",
+			Reason: "must include one of your teams",
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// unassignableTeamsError returns the validation error for teams the user is
+// not allowed to assign.
+func unassignableTeamsError(denied []string) *unleash.ValidationError {
+	return &unleash.ValidationError{
+		Field:  "AllowedTeams",
+		Reason: fmt.Sprintf("not a member of %s", strings.Join(denied, ", ")),
+	}
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/iap"
+	"github.com/nais/bifrost/pkg/teams"
+	"github.com/nais/bifrost/pkg/unleash"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+type fakeUnleashService struct {
+	unleash.IUnleashService
+	instances []*unleash.UnleashInstance
+}
+
+func (s *fakeUnleashService) List(ctx context.Context) ([]*unleash.UnleashInstance, error) {
+	return s.instances, nil
+}
+
+func (s *fakeUnleashService) Get(ctx context.Context, name string) (*unleash.UnleashInstance, error) {
+	for _, instance := range s.instances {
+		if instance.Name == name {
+			return instance, nil
+		}
+	}
+
+	return nil, apierrors.NewNotFound(unleashv1.GroupVersion.WithResource("unleashes").GroupResource(), name)
+}
+
+func (s *fakeUnleashService) Create(ctx context.Context, uc *unleash.UnleashConfig) (*unleashv1.Unleash, error) {
+	server := unleash.UnleashDefinition(&config.Config{}, uc)
+	return &server, nil
+}
+
+func (s *fakeUnleashService) Update(ctx context.Context, uc *unleash.UnleashConfig) (*unleashv1.Unleash, error) {
+	server := unleash.UnleashDefinition(&config.Config{}, uc)
+	return &server, nil
+}
+
+type fakeTeamsClient map[string][]string
+
+func (f fakeTeamsClient) UserTeams(ctx context.Context, email string) ([]string, error) {
+	return f[email], nil
+}
+
+func (f fakeTeamsClient) Teams(ctx context.Context) ([]string, error) {
+	all := []string{}
+	for _, teams := range f {
+		for _, team := range teams {
+			if !slices.Contains(all, team) {
+				all = append(all, team)
+			}
+		}
+	}
+	return all, nil
+}
+
+func newAuthorizationTestRouter(c *config.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	newInstance := func(name, teams string) *unleash.UnleashInstance {
+		uc := &unleash.UnleashConfig{Name: name, AllowedTeams: teams}
+		uc.SetDefaultValues(nil)
+		server := unleash.UnleashDefinition(c, uc)
+		return unleash.NewUnleashInstance(&server)
+	}
+
+	service := &fakeUnleashService{instances: []*unleash.UnleashInstance{
+		newInstance("team-a", "team-a"),
+		newInstance("team-b", "team-b,team-c"),
+	}}
+
+	authorizer := teams.NewAuthorizer(fakeTeamsClient{
+		"a@example.com":     {"team-a"},
+		"c@example.com":     {"team-c"},
+		"admin@example.com": {"platform"},
+	}, []string{"platform"})
+
+	h := NewHandler(c, logrus.New(), service, nil, nil, nil, authorizer, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Request = c.Request.WithContext(iap.WithUser(c.Request.Context(), user))
+		}
+	})
+	router.GET("/api/v1/unleash", h.UnleashApiList)
+	router.GET("/api/v1/unleash/:name", h.UnleashApiInstanceMiddleware, h.UnleashApiGet)
+	router.POST("/api/v1/unleash", h.UnleashApiCreate)
+	router.PUT("/api/v1/unleash/:name", h.UnleashApiInstanceMiddleware, h.UnleashApiUpdate)
+
+	return router
+}
+
+func TestInstanceAuthorization(t *testing.T) {
+	router := newAuthorizationTestRouter(&config.Config{})
+
+	get := func(path, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if user != "" {
+			req.Header.Set("X-Test-User", user)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	listNames := func(w *httptest.ResponseRecorder) []string {
+		var res UnleashInstanceListResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+		names := []string{}
+		for _, instance := range res.Instances {
+			names = append(names, instance.Name)
+		}
+		return names
+	}
+
+	w := get("/api/v1/unleash", "a@example.com")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, []string{"team-a"}, listNames(w))
+
+	w = get("/api/v1/unleash", "c@example.com")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, []string{"team-b"}, listNames(w))
+
+	w = get("/api/v1/unleash", "admin@example.com")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, []string{"team-a", "team-b"}, listNames(w))
+
+	w = get("/api/v1/unleash", "")
+	assert.Equal(t, 401, w.Code)
+
+	assert.Equal(t, 200, get("/api/v1/unleash/team-a", "a@example.com").Code)
+	assert.Equal(t, 403, get("/api/v1/unleash/team-b", "a@example.com").Code)
+	assert.Equal(t, 200, get("/api/v1/unleash/team-b", "c@example.com").Code)
+	assert.Equal(t, 200, get("/api/v1/unleash/team-b", "admin@example.com").Code)
+	assert.Equal(t, 404, get("/api/v1/unleash/team-x", "admin@example.com").Code)
+}
+
+func TestTeamAssignmentAuthorization(t *testing.T) {
+	router := newAuthorizationTestRouter(&config.Config{})
+
+	send := func(method, path, user, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", user)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name, method, path, user, body string
+		status                         int
+		validationError                string
+	}{
+		{name: "create for own team", method: "POST", path: "/api/v1/unleash", user: "a@example.com", body: `{"name": "new", "allowed-teams": "team-a"}`, status: 201},
+		{name: "create for other team", method: "POST", path: "/api/v1/unleash", user: "a@example.com", body: `{"name": "new", "allowed-teams": "team-a,team-x"}`, status: 403, validationError: "not a member of team-x"},
+		{name: "create without own team", method: "POST", path: "/api/v1/unleash", user: "a@example.com", body: `{"name": "new"}`, status: 403, validationError: "must include one of your teams"},
+		{name: "create as admin", method: "POST", path: "/api/v1/unleash", user: "admin@example.com", body: `{"name": "new", "allowed-teams": "team-x"}`, status: 201},
+		{name: "keep other team", method: "PUT", path: "/api/v1/unleash/team-b", user: "c@example.com", body: `{"log-level": "info"}`, status: 200},
+		{name: "remove own team", method: "PUT", path: "/api/v1/unleash/team-b", user: "c@example.com", body: `{"allowed-teams": "team-b"}`, status: 200},
+		{name: "remove other team", method: "PUT", path: "/api/v1/unleash/team-b", user: "c@example.com", body: `{"allowed-teams": "team-c"}`, status: 403, validationError: "not a member of team-b"},
+		{name: "add other team", method: "PUT", path: "/api/v1/unleash/team-b", user: "c@example.com", body: `{"allowed-teams": "team-b,team-c,team-x"}`, status: 403, validationError: "not a member of team-x"},
+		{name: "change teams as admin", method: "PUT", path: "/api/v1/unleash/team-b", user: "admin@example.com", body: `{"allowed-teams": "team-x"}`, status: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.path, tt.user, tt.body)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+
+			if tt.status == 403 {
+				var res ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+				assert.Contains(t, res.ValidationError, tt.validationError)
+			}
+		})
+	}
+}
@@ -1,21 +1,119 @@
 package handler
 
 import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
 	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/nais/bifrost/pkg/teams"
+	"github.com/nais/bifrost/pkg/tracing"
 	"github.com/nais/bifrost/pkg/unleash"
 	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 )
 
 type Handler struct {
-	config         *config.Config
-	logger         *logrus.Logger
-	unleashService unleash.IUnleashService
+	config          *config.Config
+	logger          *logrus.Logger
+	unleashService  unleash.IUnleashService
+	versionProvider github.VersionProvider
+	changelog       github.ChangelogProvider
+	teamsClient     teams.Client
+	authorizer      *teams.Authorizer
+	upgrader        *unleash.Upgrader
+
+	// instanceInformer notifies the status streams of changed instances.
+	// Without it the streams only send the current status.
+	instanceInformer cache.Informer
+
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
-func NewHandler(config *config.Config, logger *logrus.Logger, unleashService unleash.IUnleashService) *Handler {
+func NewHandler(config *config.Config, logger *logrus.Logger, unleashService unleash.IUnleashService, versionProvider github.VersionProvider, changelog github.ChangelogProvider, teamsClient teams.Client, authorizer *teams.Authorizer, instanceInformer cache.Informer) *Handler {
 	return &Handler{
-		config:         config,
-		logger:         logger,
-		unleashService: unleashService,
+		config:          config,
+		logger:          logger,
+		unleashService:  unleashService,
+		versionProvider: versionProvider,
+		changelog:       changelog,
+		teamsClient:     teamsClient,
+		authorizer:      authorizer,
+		upgrader: unleash.NewUpgrader(unleashService, unleash.UpgradeOptions{
+			Concurrency:  config.Unleash.UpgradeConcurrency,
+			ReadyTimeout: config.Unleash.UpgradeReadyTimeout,
+		}),
+		instanceInformer: instanceInformer,
+		shutdown:         make(chan struct{}),
 	}
 }
+
+// Shutdown ends open streams and stops the running fleet upgrade. It waits
+// for the upgrade to record its result until ctx is done.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.shutdownOnce.Do(func() { close(h.shutdown) })
+
+	return h.upgrader.Stop(ctx)
+}
+
+// log returns the logger of the request, which carries the request ID, the
+// user and the instance name.
+func (h *Handler) log(c *gin.Context) *logrus.Entry {
+	return h.logContext(c.Request.Context())
+}
+
+// logContext returns the logger of the request ctx belongs to, for helpers
+// that are passed a context rather than the gin context.
+func (h *Handler) logContext(ctx context.Context) *logrus.Entry {
+	return logging.FromContext(logging.WithDefault(ctx, h.logger))
+}
+
+// setInstance stores the instance in the gin context and adds its name to the
+// request logger and span.
+func (h *Handler) setInstance(c *gin.Context, instance *unleash.UnleashInstance) {
+	c.Set("unleashInstance", instance)
+	c.Request = c.Request.WithContext(logging.WithFields(c.Request.Context(), logrus.Fields{"instance": instance.Name}))
+	tracing.SetInstance(c.Request.Context(), instance.Name)
+}
+
+// streamContext returns the context of a long-lived response, such as a
+// server-sent event stream, which is cancelled when the client disconnects or
+// the handler shuts down. The server's write timeout does not apply to the
+// response.
+func (h *Handler) streamContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	// Response writers in tests do not support deadlines
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	go func() {
+		select {
+		case <-h.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// unleashVersions returns the available Unleash versions, or none if they
+// cannot be looked up.
+func (h *Handler) unleashVersions(ctx context.Context) []github.UnleashVersion {
+	if h.versionProvider == nil {
+		return []github.UnleashVersion{}
+	}
+
+	versions, err := h.versionProvider.UnleashVersions(ctx)
+	if err != nil {
+		h.logContext(ctx).WithError(err).Error("Error getting Unleash versions")
+		return []github.UnleashVersion{}
+	}
+
+	return versions
+}
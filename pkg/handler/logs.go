@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/unleash"
+)
+
+// logTailOptions are the tail lengths offered in the log viewer.
+var logTailOptions = []int64{100, unleash.DefaultLogTailLines, 1000, 5000, unleash.MaxLogTailLines}
+
+func logOptions(c *gin.Context) (unleash.LogOptions, error) {
+	opts := unleash.LogOptions{
+		Pod:       c.Query("pod"),
+		Container: c.DefaultQuery("container", unleash.UnleashContainer),
+		TailLines: unleash.DefaultLogTailLines,
+	}
+
+	if tail := c.Query("tail"); tail != "" {
+		tailLines, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil || tailLines < 1 {
+			return opts, fmt.Errorf("invalid tail %q", tail)
+		}
+		opts.TailLines = tailLines
+	}
+
+	return opts, nil
+}
+
+func logErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, unleash.ErrLogTargetNotFound):
+		return 404
+	case errors.Is(err, unleash.ErrLogsUnavailable):
+		return 503
+	default:
+		return 500
+	}
+}
+
+// openLogs opens the logs selected in the query, or responds with an error.
+func (h *Handler) openLogs(ctx context.Context, c *gin.Context, follow bool) (io.ReadCloser, unleash.LogOptions, bool) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	opts, err := logOptions(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, opts, false
+	}
+	opts.Follow = follow
+
+	stream, err := h.unleashService.Logs(ctx, instance.Name, opts)
+	if err != nil {
+		h.log(c).WithError(err).Errorf("Error reading logs for Unleash instance %s", instance.Name)
+		c.JSON(logErrorStatus(err), gin.H{"error": "Error reading logs, " + err.Error()})
+		return nil, opts, false
+	}
+
+	return stream, opts, true
+}
+
+func (h *Handler) UnleashInstanceLogs(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	pods, err := h.unleashService.Pods(c.Request.Context(), instance.Name)
+	if err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error getting pods for unleash instance")
+		return
+	}
+
+	opts, err := logOptions(c)
+	if err != nil {
+		opts.TailLines = unleash.DefaultLogTailLines
+	}
+
+	c.HTML(200, "unleash-logs.html", gin.H{
+		"title":       "Logs: " + instance.Name,
+		"instance":    instance,
+		"pods":        pods,
+		"containers":  unleash.LogContainers,
+		"tailOptions": logTailOptions,
+		"options":     opts,
+	})
+}
+
+// UnleashInstanceLogsStream streams the selected logs as server-sent "log"
+// events, one per line, and follows them until the client disconnects or the
+// server shuts down. An "end" event is sent when the stream ends.
+func (h *Handler) UnleashInstanceLogsStream(c *gin.Context) {
+	ctx, cancel := h.streamContext(c)
+	defer cancel()
+
+	stream, _, ok := h.openLogs(ctx, c, c.DefaultQuery("follow", "true") == "true")
+	if !ok {
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			c.SSEvent("log", strings.TrimRight(line, "\r\n"))
+		}
+
+		// Send lines in batches while the tail is read, and one by one after
+		if err != nil || reader.Buffered() == 0 {
+			c.Writer.Flush()
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				h.log(c).WithError(err).Error("Error streaming logs")
+			}
+			break
+		}
+	}
+
+	c.SSEvent("end", "")
+	c.Writer.Flush()
+}
+
+// UnleashInstanceLogsDownload returns the selected logs as a text file.
+func (h *Handler) UnleashInstanceLogsDownload(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	stream, opts, ok := h.openLogs(c.Request.Context(), c, false)
+	if !ok {
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.log"`, instance.Name, opts.Container))
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(200)
+
+	if _, err := io.Copy(c.Writer, stream); err != nil {
+		h.log(c).WithError(err).Error("Error downloading logs")
+	}
+}
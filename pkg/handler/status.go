@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/unleash"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// InstanceStatus is the part of an instance that changes while Unleasherator
+// reconciles it. It is pushed to the browser by the status streams.
+type InstanceStatus struct {
+	Name       string              `json:"name"`
+	Status     unleash.Status      `json:"status"`
+	Label      string              `json:"label"`
+	Ready      bool                `json:"ready"`
+	Version    string              `json:"version"`
+	Conditions []unleash.Condition `json:"conditions"`
+}
+
+func NewInstanceStatus(instance *unleash.UnleashInstance) InstanceStatus {
+	return InstanceStatus{
+		Name:       instance.Name,
+		Status:     instance.Status(),
+		Label:      instance.StatusLabel(),
+		Ready:      instance.IsReady(),
+		Version:    instance.Version(),
+		Conditions: instance.Conditions(),
+	}
+}
+
+// streamStatus sends a "status" event for every instance returned by load,
+// and again whenever the informer reports a change to an instance named name
+// that changes its status. An empty name matches every instance. Instances
+// that disappear are sent as a "deleted" event. The stream ends when the
+// client disconnects or the server shuts down.
+func (h *Handler) streamStatus(c *gin.Context, name string, load func(ctx context.Context) ([]*unleash.UnleashInstance, error)) {
+	ctx, cancel := h.streamContext(c)
+	defer cancel()
+
+	// Changes are coalesced, every reload reads the latest state from the
+	// informer cache.
+	changed := make(chan struct{}, 1)
+	notify := func(obj interface{}) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	if h.instanceInformer != nil {
+		// The handler is added before the first load, so no change is missed
+		registration, err := h.instanceInformer.AddEventHandler(toolscache.FilteringResourceEventHandler{
+			FilterFunc: func(obj interface{}) bool {
+				return name == "" || objectName(obj) == name
+			},
+			Handler: toolscache.ResourceEventHandlerFuncs{
+				AddFunc:    notify,
+				UpdateFunc: func(oldObj, newObj interface{}) { notify(newObj) },
+				DeleteFunc: notify,
+			},
+		})
+		if err != nil {
+			h.log(c).WithError(err).Error("Error watching Unleash instances for status stream")
+			c.AbortWithStatus(500)
+			return
+		}
+
+		defer func() {
+			if err := h.instanceInformer.RemoveEventHandler(registration); err != nil {
+				h.log(c).WithError(err).Error("Error removing status stream event handler")
+			}
+		}()
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+	c.Writer.Flush()
+
+	sent := map[string]InstanceStatus{}
+	for {
+		instances, err := load(ctx)
+		if err != nil && ctx.Err() == nil {
+			h.log(c).WithError(err).Error("Error getting Unleash instances for status stream")
+		}
+
+		if err == nil {
+			seen := map[string]bool{}
+			for _, instance := range instances {
+				status := NewInstanceStatus(instance)
+				seen[status.Name] = true
+
+				if previous, ok := sent[status.Name]; ok && reflect.DeepEqual(previous, status) {
+					continue
+				}
+
+				sent[status.Name] = status
+				c.SSEvent("status", status)
+			}
+
+			for name := range sent {
+				if !seen[name] {
+					delete(sent, name)
+					c.SSEvent("deleted", gin.H{"name": name})
+				}
+			}
+
+			c.Writer.Flush()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// objectName returns the name of an object passed to an informer event
+// handler, which is wrapped in a tombstone when a deletion was missed.
+func objectName(obj interface{}) string {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	if object, ok := obj.(metav1.Object); ok {
+		return object.GetName()
+	}
+
+	return ""
+}
+
+// UnleashStatusStream streams status changes of the instances the user can
+// access.
+func (h *Handler) UnleashStatusStream(c *gin.Context) {
+	h.streamStatus(c, "", func(ctx context.Context) ([]*unleash.UnleashInstance, error) {
+		instances, err := h.unleashService.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return h.accessibleInstances(c, instances)
+	})
+}
+
+// UnleashInstanceStatusStream streams status changes of a single instance.
+func (h *Handler) UnleashInstanceStatusStream(c *gin.Context) {
+	name := c.MustGet("unleashInstance").(*unleash.UnleashInstance).Name
+
+	h.streamStatus(c, name, func(ctx context.Context) ([]*unleash.UnleashInstance, error) {
+		instance, err := h.unleashService.Get(ctx, name)
+		if unleash.IsNotFound(err) {
+			return []*unleash.UnleashInstance{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return []*unleash.UnleashInstance{instance}, nil
+	})
+}
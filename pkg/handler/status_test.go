@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/unleash"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// statusTestService is a fakeUnleashService that can be changed while a
+// stream is reading from it.
+type statusTestService struct {
+	mu sync.Mutex
+	fakeUnleashService
+}
+
+func (s *statusTestService) set(instances ...*unleash.UnleashInstance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instances = instances
+}
+
+func (s *statusTestService) List(ctx context.Context) ([]*unleash.UnleashInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fakeUnleashService.List(ctx)
+}
+
+func (s *statusTestService) Get(ctx context.Context, name string) (*unleash.UnleashInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fakeUnleashService.Get(ctx, name)
+}
+
+// statusTestInformer delivers events to the handlers added by the status
+// streams, like the Unleash informer does.
+type statusTestInformer struct {
+	mu       sync.Mutex
+	handlers map[*statusTestRegistration]toolscache.ResourceEventHandler
+}
+
+type statusTestRegistration struct{}
+
+func (r *statusTestRegistration) HasSynced() bool { return true }
+
+func newStatusTestInformer() *statusTestInformer {
+	return &statusTestInformer{handlers: map[*statusTestRegistration]toolscache.ResourceEventHandler{}}
+}
+
+func (i *statusTestInformer) AddEventHandler(handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	registration := &statusTestRegistration{}
+	i.handlers[registration] = handler
+	return registration, nil
+}
+
+func (i *statusTestInformer) AddEventHandlerWithResyncPeriod(handler toolscache.ResourceEventHandler, _ time.Duration) (toolscache.ResourceEventHandlerRegistration, error) {
+	return i.AddEventHandler(handler)
+}
+
+func (i *statusTestInformer) RemoveEventHandler(handle toolscache.ResourceEventHandlerRegistration) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.handlers, handle.(*statusTestRegistration))
+	return nil
+}
+
+func (i *statusTestInformer) AddIndexers(toolscache.Indexers) error { return nil }
+func (i *statusTestInformer) HasSynced() bool                       { return true }
+func (i *statusTestInformer) IsStopped() bool                       { return false }
+
+func (i *statusTestInformer) len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.handlers)
+}
+
+func (i *statusTestInformer) update(obj *unleashv1.Unleash) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, handler := range i.handlers {
+		handler.OnUpdate(obj, obj)
+	}
+}
+
+func (i *statusTestInformer) delete(obj *unleashv1.Unleash) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, handler := range i.handlers {
+		handler.OnDelete(toolscache.DeletedFinalStateUnknown{Key: obj.Namespace + "/" + obj.Name, Obj: obj})
+	}
+}
+
+type statusEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+func readStatusEvent(t *testing.T, r *bufio.Reader) statusEvent {
+	t.Helper()
+
+	var event statusEvent
+	for {
+		line, err := r.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return event
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event.name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event.data))
+		case line == "" && event.name != "":
+			return event
+		}
+	}
+}
+
+func TestUnleashStatusStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c := &config.Config{}
+	newInstance := func(ready bool) *unleash.UnleashInstance {
+		server := unleash.UnleashDefinition(c, &unleash.UnleashConfig{Name: "team-a"})
+		if ready {
+			server.Status.Version = "5.7.0"
+			server.Status.Conditions = []metav1.Condition{
+				{Type: unleashv1.UnleashStatusConditionTypeReconciled, Status: metav1.ConditionTrue, Reason: "Reconciling"},
+				{Type: unleashv1.UnleashStatusConditionTypeConnected, Status: metav1.ConditionTrue, Reason: "Reconciling"},
+			}
+		}
+		return unleash.NewUnleashInstance(&server)
+	}
+
+	service := &statusTestService{}
+	service.set(newInstance(false))
+
+	informer := newStatusTestInformer()
+	h := NewHandler(c, logrus.New(), service, nil, nil, nil, nil, informer)
+
+	router := gin.New()
+	router.GET("/unleash/stream", h.UnleashStatusStream)
+	router.GET("/unleash/:id/stream", h.UnleashInstanceMiddleware, h.UnleashInstanceStatusStream)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, path := range []string{"/unleash/stream", "/unleash/team-a/stream"} {
+		t.Run(path, func(t *testing.T) {
+			service.set(newInstance(false))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+path, nil)
+			res, err := http.DefaultClient.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, 200, res.StatusCode)
+			assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+			r := bufio.NewReader(res.Body)
+
+			event := readStatusEvent(t, r)
+			assert.Equal(t, "status", event.name)
+			assert.Equal(t, "team-a", event.data["name"])
+			assert.Equal(t, "Provisioning", event.data["status"])
+			assert.Equal(t, "blue", event.data["label"])
+
+			// Changes to other instances do not reload the stream
+			other := unleash.UnleashDefinition(c, &unleash.UnleashConfig{Name: "team-b"})
+			informer.update(&other)
+
+			ready := newInstance(true)
+			service.set(ready)
+			informer.update(ready.ServerInstance)
+
+			event = readStatusEvent(t, r)
+			assert.Equal(t, "status", event.name)
+			assert.Equal(t, "Ready", event.data["status"])
+			assert.Equal(t, "green", event.data["label"])
+			assert.Equal(t, "5.7.0", event.data["version"])
+			assert.Len(t, event.data["conditions"], 2)
+
+			service.set()
+			informer.delete(ready.ServerInstance)
+
+			event = readStatusEvent(t, r)
+			assert.Equal(t, "deleted", event.name)
+			assert.Equal(t, "team-a", event.data["name"])
+
+			cancel()
+			assert.Eventually(t, func() bool { return informer.len() == 0 }, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestUnleashStatusStreamShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c := &config.Config{}
+	server := unleash.UnleashDefinition(c, &unleash.UnleashConfig{Name: "team-a"})
+
+	service := &statusTestService{}
+	service.set(unleash.NewUnleashInstance(&server))
+
+	informer := newStatusTestInformer()
+	h := NewHandler(c, logrus.New(), service, nil, nil, nil, nil, informer)
+
+	router := gin.New()
+	router.GET("/unleash/stream", h.UnleashStatusStream)
+
+	// Streams outlive the write timeout of the server
+	ts := httptest.NewUnstartedServer(router)
+	ts.Config.WriteTimeout = 20 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/unleash/stream")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+
+	r := bufio.NewReader(res.Body)
+	assert.Equal(t, "status", readStatusEvent(t, r).name)
+
+	time.Sleep(50 * time.Millisecond)
+	service.set()
+	informer.delete(&server)
+	assert.Equal(t, "deleted", readStatusEvent(t, r).name)
+
+	assert.NoError(t, h.Shutdown(context.Background()))
+
+	_, err = io.ReadAll(r)
+	assert.NoError(t, err)
+}
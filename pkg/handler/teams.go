@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/teams"
+)
+
+const teamsSearchLimit = 20
+
+type TeamsResponse struct {
+	Teams []string `json:"teams"`
+}
+
+type NamespacesResponse struct {
+	Namespaces []string `json:"namespaces"`
+}
+
+func (h *Handler) searchTeams(c *gin.Context) ([]string, bool) {
+	if h.teamsClient == nil {
+		return []string{}, true
+	}
+
+	matches, err := teams.Search(c.Request.Context(), h.teamsClient, c.Query("q"), teamsSearchLimit)
+	if err != nil {
+		h.apiError(c, 502, err, "Error getting teams from the Teams API")
+		return nil, false
+	}
+
+	return matches, true
+}
+
+func (h *Handler) TeamsApiSearch(c *gin.Context) {
+	matches, ok := h.searchTeams(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, TeamsResponse{Teams: matches})
+}
+
+// NamespacesApiSearch returns matching namespaces. Every team has a namespace
+// named after its slug, so this is the same list as for teams.
+func (h *Handler) NamespacesApiSearch(c *gin.Context) {
+	matches, ok := h.searchTeams(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, NamespacesResponse{Namespaces: matches})
+}
+
+// existingTeams returns the teams that allowed teams and namespaces are
+// validated against, or nil when validation is disabled. Validation is
+// skipped rather than failing when the Teams API is unavailable. The current
+// teams of an instance are always allowed, so an instance can still be edited
+// after one of its teams has been deleted.
+func (h *Handler) existingTeams(ctx context.Context, current []string) []string {
+	if h.teamsClient == nil || !h.config.Teams.ValidationEnabled {
+		return nil
+	}
+
+	existing, err := h.teamsClient.Teams(ctx)
+	if err != nil {
+		h.logContext(ctx).WithError(err).Warn("Error getting teams from the Teams API, skipping team validation")
+		return nil
+	}
+
+	// The teams may be shared with the cache, so they are copied before
+	// appending
+	return append(append([]string{}, existing...), current...)
+}
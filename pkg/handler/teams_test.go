@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/nais/bifrost/pkg/unleash"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTeamsTestRouter(c *config.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	newInstance := func(name, teams string) *unleash.UnleashInstance {
+		uc := &unleash.UnleashConfig{Name: name, AllowedTeams: teams}
+		uc.SetDefaultValues(nil)
+		server := unleash.UnleashDefinition(c, uc)
+		return unleash.NewUnleashInstance(&server)
+	}
+
+	service := &fakeUnleashService{instances: []*unleash.UnleashInstance{
+		newInstance("team-a", "team-a"),
+		newInstance("legacy", "team-a,deleted-team"),
+	}}
+	teamsClient := fakeTeamsClient{"a@example.com": {"team-a", "team-b", "other"}}
+
+	h := NewHandler(c, logrus.New(), service, nil, nil, teamsClient, nil, nil)
+
+	router := gin.New()
+	router.GET("/api/v1/teams", h.TeamsApiSearch)
+	router.GET("/api/v1/namespaces", h.NamespacesApiSearch)
+	router.PUT("/api/v1/unleash/:name", h.UnleashApiInstanceMiddleware, h.UnleashApiUpdate)
+
+	return router
+}
+
+func TestTeamsApiSearch(t *testing.T) {
+	router := newTeamsTestRouter(&config.Config{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/teams?q=team", nil)
+	router.ServeHTTP(w, req)
+
+	var teams TeamsResponse
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &teams))
+	assert.Equal(t, []string{"team-a", "team-b"}, teams.Teams)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/namespaces?q=oth", nil)
+	router.ServeHTTP(w, req)
+
+	var namespaces NamespacesResponse
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &namespaces))
+	assert.Equal(t, []string{"other"}, namespaces.Namespaces)
+}
+
+func TestUnknownTeamsAreRejected(t *testing.T) {
+	c := &config.Config{}
+	c.Teams.ValidationEnabled = true
+	router := newTeamsTestRouter(c)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/unleash/team-a", strings.NewReader(`{"allowed-teams": "team-a,team-typo"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	var res ErrorResponse
+	assert.Equal(t, 400, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Contains(t, res.ValidationError, "'AllowedTeams' failed on the 'teams' tag")
+}
+
+func TestDeletedTeamsOnInstanceAreAccepted(t *testing.T) {
+	c := &config.Config{}
+	c.Teams.ValidationEnabled = true
+	router := newTeamsTestRouter(c)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/unleash/legacy", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := put(`{"log-level": "info"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+
+	// Teams that do not exist can still not be added
+	w = put(`{"allowed-teams": "team-a,deleted-team,other-deleted-team"}`)
+	assert.Equal(t, 400, w.Code)
+}
+
+type failingTeamsClient struct{}
+
+func (failingTeamsClient) UserTeams(ctx context.Context, email string) ([]string, error) {
+	return nil, errors.New("teams api unavailable")
+}
+
+func (failingTeamsClient) Teams(ctx context.Context) ([]string, error) {
+	return nil, errors.New("teams api unavailable")
+}
+
+func TestExistingTeamsLogsToRequestLogger(t *testing.T) {
+	c := &config.Config{Teams: config.TeamsConfig{ValidationEnabled: true}}
+	h := NewHandler(c, logrus.New(), &fakeUnleashService{}, nil, nil, failingTeamsClient{}, nil, nil)
+
+	logger, hook := test.NewNullLogger()
+	ctx := logging.NewContext(context.Background(), logger.WithField("request_id", "abc123"))
+
+	assert.Nil(t, h.existingTeams(ctx, []string{"team-a"}))
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, "abc123", hook.LastEntry().Data["request_id"])
+		assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,12 +21,25 @@ func (h *Handler) HealthHandler(c *gin.Context) {
 	c.String(200, "OK")
 }
 
+// ReadinessHandler responds with 503 until ready reports true, e.g. while the
+// Kubernetes cache is syncing. A nil ready is always ready.
+func (h *Handler) ReadinessHandler(ready func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ready != nil && !ready() {
+			c.String(503, "Not ready")
+			return
+		}
+
+		c.String(200, "OK")
+	}
+}
+
 func (h *Handler) ErrorHandler(c *gin.Context) {
 	c.Next()
 
 	errorToPrint := c.Errors.ByType(gin.ErrorTypePublic).Last()
 	if errorToPrint != nil {
-		h.logger.WithError(errorToPrint.Err).Error(errorToPrint.Meta)
+		h.log(c).WithError(errorToPrint.Err).Error(errorToPrint.Meta)
 		c.HTML(500, "error.html", gin.H{
 			"title": "Error",
 			"error": errorToPrint.Meta,
@@ -42,31 +57,46 @@ func (h *Handler) UnleashIndex(c *gin.Context) {
 		return
 	}
 
+	instances, err = h.accessibleInstances(c, instances)
+	if err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error checking access to unleash instances")
+		return
+	}
+
+	drifted := map[string]bool{}
+	for _, instance := range instances {
+		drift, err := unleash.SpecDrift(h.config, instance.ServerInstance)
+		if err != nil {
+			h.log(c).WithError(err).Errorf("Error computing drift for Unleash instance %s", instance.Name)
+			continue
+		}
+		drifted[instance.Name] = len(drift) > 0
+	}
+
 	status := template.HTMLEscapeString(c.Query("status"))
 	c.HTML(200, "unleash-index.html", gin.H{
 		"title":     "Unleash as a Service (UaaS))",
 		"instances": instances,
+		"drifted":   drifted,
 		"status":    status,
 	})
 }
 
 func (h *Handler) UnleashNew(c *gin.Context) {
-	unleashVersions, err := github.UnleashVersions()
-	if err != nil {
-		h.logger.WithError(err).Error("Error getting Unleash versions from Github")
-		unleashVersions = []github.UnleashVersion{}
-	}
+	unleashVersions := h.unleashVersions(c.Request.Context())
 
 	obj := unleash.UnleashDefinition(h.config, &unleash.UnleashConfig{Name: "my-unleash"})
 	yamlString, err := utils.StructToYaml(obj)
 	if err != nil {
-		h.logger.WithError(err).Error("Error converting Unleash struct to yaml")
+		h.log(c).WithError(err).Error("Error converting Unleash struct to yaml")
 		yamlString = "Parse error - see logs"
 	}
 
 	uc := unleash.UnleashConfig{
 		Name:                      "",
-		CustomVersion:             unleashVersions[0].GitTag,
+		CustomVersion:             "",
 		EnableFederation:          true,
 		FederationNonce:           "",
 		AllowedTeams:              "",
@@ -76,6 +106,9 @@ func (h *Handler) UnleashNew(c *gin.Context) {
 		DatabasePoolMax:           0,
 		DatabasePoolIdleTimeoutMs: 0,
 	}
+	if latest, ok := github.LatestUnleashVersion(unleashVersions); ok {
+		uc.CustomVersion = latest.GitTag
+	}
 
 	c.HTML(200, "unleash-form.html", gin.H{
 		"title":           "New Unleash Instance",
@@ -91,17 +124,33 @@ func (h *Handler) UnleashInstanceMiddleware(c *gin.Context) {
 	teamName := c.Param("id")
 	ctx := c.Request.Context()
 
-	// @TODO check if user is allowed to access this instance
-
 	instance, err := h.unleashService.Get(ctx, teamName)
 	if err != nil {
-		h.logger.Info(err)
+		h.log(c).Info(err)
 		c.Redirect(301, "/unleash?status=not-found")
 		c.Abort()
 		return
 	}
 
-	c.Set("unleashInstance", instance)
+	allowed, err := h.canAccessInstance(c, instance)
+	if err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error checking access to unleash instance")
+		c.Abort()
+		return
+	}
+
+	if !allowed {
+		c.HTML(403, "error.html", gin.H{
+			"title": "Forbidden",
+			"error": "You are not a member of any of the teams allowed to access this instance",
+		})
+		c.Abort()
+		return
+	}
+
+	h.setInstance(c, instance)
 	c.Next()
 }
 
@@ -109,16 +158,34 @@ func (h *Handler) UnleashInstanceShow(c *gin.Context) {
 	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
 	instanceYaml, err := utils.StructToYaml(instance.ServerInstance)
 	if err != nil {
-		h.logger.WithError(err).Error("Error converting Unleash struct to yaml")
+		h.log(c).WithError(err).Error("Error converting Unleash struct to yaml")
 		instanceYaml = "Parse error - see logs"
 	}
 
 	uc := unleash.UnleashVariables(instance.ServerInstance, false)
 
+	status := template.HTMLEscapeString(c.Query("status"))
+	repaired := utils.SplitNoEmpty(template.HTMLEscapeString(c.Query("repaired")), ",")
+
+	drift, err := unleash.SpecDrift(h.config, instance.ServerInstance)
+	if err != nil {
+		h.log(c).WithError(err).Error("Error computing drift for Unleash instance")
+	}
+
+	events, err := h.unleashService.Events(c.Request.Context(), instance.Name)
+	if err != nil {
+		h.log(c).WithError(err).Error("Error getting events for Unleash instance")
+	}
+
 	c.HTML(200, "unleash-show.html", gin.H{
 		"title":              "Unleash: " + instance.Name,
 		"instance":           instance,
 		"unleash":            uc,
+		"status":             status,
+		"repaired":           repaired,
+		"drift":              drift,
+		"events":             events,
+		"eventsError":        err != nil,
 		"googleProjectID":    h.config.Google.ProjectID,
 		"googleProjectURL":   h.config.GoogleProjectURL(""),
 		"sqlInstanceID":      h.config.Unleash.SQLInstanceID,
@@ -133,15 +200,89 @@ func (h *Handler) UnleashInstanceShow(c *gin.Context) {
 	})
 }
 
+func (h *Handler) UnleashInstanceDrift(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	drift, err := unleash.SpecDrift(h.config, instance.ServerInstance)
+	if err != nil {
+		h.log(c).WithError(err).Error("Error computing drift for Unleash instance")
+		c.JSON(500, gin.H{
+			"error": "Error computing drift for Unleash instance",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"name":    instance.Name,
+		"drifted": len(drift) > 0,
+		"fields":  drift,
+	})
+}
+
+// UnleashInstanceEvents returns the Kubernetes events for the instance, its
+// Deployment and pods, newest first.
+func (h *Handler) UnleashInstanceEvents(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	events, err := h.unleashService.Events(c.Request.Context(), instance.Name)
+	if err != nil {
+		h.log(c).WithError(err).Error("Error getting events for Unleash instance")
+		c.JSON(500, gin.H{"error": "Error getting events for Unleash instance"})
+		return
+	}
+
+	c.JSON(200, UnleashInstanceEventsResponse{Name: instance.Name, Events: events})
+}
+
+// UnleashInstanceChanges returns the commits and release notes between the
+// instance's current custom version and the version in the query.
+func (h *Handler) UnleashInstanceChanges(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	version := c.Query("version")
+	if version == "" {
+		c.JSON(400, gin.H{"error": "Missing version"})
+		return
+	}
+
+	current := unleash.UnleashVariables(instance.ServerInstance, false).CustomVersion
+	if current == "" {
+		c.JSON(400, gin.H{"error": "Instance does not run a custom version"})
+		return
+	}
+
+	if h.changelog == nil {
+		c.JSON(500, gin.H{"error": "Release notes are not available"})
+		return
+	}
+
+	if current == version {
+		c.JSON(200, &github.Changes{Base: current, Head: version, Commits: []github.Commit{}, Releases: []github.Release{}})
+		return
+	}
+
+	changes, err := h.changelog.UnleashChanges(c.Request.Context(), current, version)
+	if err != nil {
+		h.log(c).WithError(err).Error("Error getting changes between Unleash versions")
+		c.JSON(500, gin.H{"error": "Error getting changes between Unleash versions"})
+		return
+	}
+
+	c.JSON(200, changes)
+}
+
 func (h *Handler) UnleashInstanceEdit(c *gin.Context) {
 	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
 
 	uc := unleash.UnleashVariables(instance.ServerInstance, true)
 
-	unleashVersions, err := github.UnleashVersions()
-	if err != nil {
-		h.logger.WithError(err).Error("Error getting Unleash versions from Github")
-		unleashVersions = []github.UnleashVersion{}
+	unleashVersions := h.unleashVersions(c.Request.Context())
+
+	var latestPatch *github.UnleashVersion
+	if current, err := github.ParseSemver(instance.Version()); err == nil {
+		if latest, ok := github.LatestPatch(unleashVersions, current); ok && latest.Semver.Compare(current) > 0 {
+			latestPatch = &latest
+		}
 	}
 
 	c.HTML(200, "unleash-form.html", gin.H{
@@ -149,6 +290,7 @@ func (h *Handler) UnleashInstanceEdit(c *gin.Context) {
 		"action":          "edit",
 		"unleash":         uc,
 		"unleashVersions": unleashVersions,
+		"latestPatch":     latestPatch,
 	})
 }
 
@@ -159,7 +301,7 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 	)
 
 	ctx := c.Request.Context()
-	log := h.logger.WithContext(ctx)
+	log := h.log(c)
 	uc := &unleash.UnleashConfig{}
 
 	instance, exists := c.Get("unleashInstance")
@@ -174,9 +316,8 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 		uc = unleash.UnleashVariables(instance.ServerInstance, true)
 	}
 
-	unleashVersions, err := github.UnleashVersions()
-	if err != nil {
-		log.WithError(err).Error("Error getting Unleash versions from Github")
+	unleashVersions := h.unleashVersions(ctx)
+	if len(unleashVersions) == 0 {
 		unleashVersions = []github.UnleashVersion{
 			{
 				GitTag:        "v5.10.2-20240329-070801-0180a96",
@@ -207,32 +348,63 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 	//  We are removing the differentiating between teams and namespaces, and merging them into one field
 	uc.MergeTeamsAndNamespaces()
 
-	if validationErr := uc.Validate(); validationErr != nil {
-		log.WithError(validationErr).Error("Error validating Unleash config")
+	if exists {
+		title = "Edit Unleash: " + uc.Name
+		action = "edit"
+	} else {
+		title = "New Unleash Instance"
+		action = "create"
+	}
 
-		if exists {
-			title = "Edit Unleash: " + uc.Name
-			action = "edit"
-		} else {
-			title = "New Unleash Instance"
-			action = "create"
-		}
+	renderValidationError := func(code int, validationErr error) {
+		log.WithError(validationErr).Error("Error validating Unleash config")
 
 		if c.ContentType() == "application/json" {
-			c.JSON(400, gin.H{
+			c.JSON(code, gin.H{
 				"error":           "Input validation failed, see errors in details",
 				"validationError": validationErr.Error(),
 			})
-		} else {
-			c.HTML(400, "unleash-form.html", gin.H{
-				"title":           title,
-				"action":          action,
-				"unleash":         uc,
-				"unleashVersions": unleashVersions,
-				"validationError": validationErr,
-				"error":           "Input validation failed, see errors in details",
-			})
+			return
+		}
+
+		data := gin.H{
+			"title":           title,
+			"action":          action,
+			"unleash":         uc,
+			"unleashVersions": unleashVersions,
+			"validationError": validationErr,
+			"error":           "Input validation failed, see errors in details",
+		}
+
+		var fieldErr *unleash.ValidationError
+		if errors.As(validationErr, &fieldErr) {
+			data["error"] = validationErr.Error()
+			data[strings.ToLower(fieldErr.Field[:1])+fieldErr.Field[1:]+"Error"] = true
 		}
+
+		c.HTML(code, "unleash-form.html", data)
+	}
+
+	currentTeams := []string{}
+	if exists {
+		currentTeams = assignedTeams(instance.(*unleash.UnleashInstance))
+	}
+
+	if validationErr := uc.Validate(h.existingTeams(ctx, currentTeams)); validationErr != nil {
+		renderValidationError(400, validationErr)
+		return
+	}
+
+	teamsErr, err := h.teamAssignmentError(c, currentTeams, uc.AllowedTeams, !exists)
+	if err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error checking access to teams")
+		return
+	}
+
+	if teamsErr != nil {
+		renderValidationError(403, teamsErr)
 		return
 	}
 
@@ -244,11 +416,22 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 		unleashInstance, err = h.unleashService.Create(ctx, uc)
 	}
 
+	var validationErr *unleash.ValidationError
+	if errors.As(err, &validationErr) {
+		renderValidationError(400, validationErr)
+		return
+	}
+
 	if err != nil {
-		var unleashErr *unleash.UnleashError
+		var (
+			provisionErr *unleash.ProvisionError
+			unleashErr   *unleash.UnleashError
+		)
 
 		reason := "Error persisting Unleash instance, check server logs"
-		if errors.As(err, &unleashErr) {
+		if errors.As(err, &provisionErr) {
+			reason = fmt.Sprintf("Error persisting Unleash instance, %s", provisionErr.Error())
+		} else if errors.As(err, &unleashErr) {
 			err = unleashErr.Err
 			reason = fmt.Sprintf("Error persisting Unleash instance, %s", unleashErr.Reason)
 		}
@@ -300,3 +483,33 @@ func (h *Handler) UnleashInstanceDeletePost(c *gin.Context) {
 
 	c.Redirect(302, "/unleash")
 }
+
+func (h *Handler) UnleashInstanceRepairPost(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	ctx := c.Request.Context()
+
+	repaired, err := h.unleashService.Repair(ctx, instance.Name)
+	if err != nil {
+		reason := "Error repairing Unleash instance, check server logs"
+
+		var unleashErr *unleash.UnleashError
+		if errors.As(err, &unleashErr) {
+			err = unleashErr.Err
+			reason = fmt.Sprintf("Error repairing Unleash instance, %s", unleashErr.Reason)
+		}
+
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta(reason)
+		return
+	}
+
+	h.log(c).WithField("repaired", repaired).Infof("Repaired Unleash instance %s", instance.Name)
+
+	query := url.Values{}
+	query.Set("status", "repaired")
+	query.Set("repaired", strings.Join(repaired, ","))
+
+	c.Redirect(302, fmt.Sprintf("/unleash/%s/?%s", instance.Name, query.Encode()))
+}
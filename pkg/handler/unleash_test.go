@@ -1 +1,66 @@
 package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
+	"github.com/nais/bifrost/pkg/unleash"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeChangelog struct {
+	base, head string
+}
+
+func (f *fakeChangelog) UnleashChanges(ctx context.Context, base, head string) (*github.Changes, error) {
+	f.base, f.head = base, head
+	return &github.Changes{
+		Base:     base,
+		Head:     head,
+		Commits:  []github.Commit{{Sha: "1111111", Message: "Fix bug"}},
+		Releases: []github.Release{},
+	}, nil
+}
+
+func TestUnleashInstanceChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c := &config.Config{}
+	custom := unleash.UnleashDefinition(c, &unleash.UnleashConfig{Name: "team-a", CustomVersion: "v5.7.0-20231101-090000-9999999"})
+	standard := unleash.UnleashDefinition(c, &unleash.UnleashConfig{Name: "team-b"})
+	service := &fakeUnleashService{instances: []*unleash.UnleashInstance{
+		unleash.NewUnleashInstance(&custom),
+		unleash.NewUnleashInstance(&standard),
+	}}
+	changelog := &fakeChangelog{}
+
+	h := NewHandler(c, logrus.New(), service, nil, changelog, nil, nil, nil)
+
+	router := gin.New()
+	router.GET("/unleash/:id/changes", h.UnleashInstanceMiddleware, h.UnleashInstanceChanges)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/changes?version=v5.8.0-20240101-090000-bbbbbbb", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "v5.7.0-20231101-090000-9999999", changelog.base)
+	assert.Equal(t, "v5.8.0-20240101-090000-bbbbbbb", changelog.head)
+	assert.Contains(t, w.Body.String(), `"message":"Fix bug"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/changes", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-b/changes?version=v5.8.0-20240101-090000-bbbbbbb", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"error":"Instance does not run a custom version"}`, w.Body.String())
+}
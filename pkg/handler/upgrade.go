@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/unleash"
+)
+
+// UpgradeRequest selects the instances of a fleet upgrade and the version
+// they are upgraded to.
+type UpgradeRequest struct {
+	Version string `json:"version" form:"version"`
+	unleash.UpgradeFilter
+	Concurrency int  `json:"concurrency,omitempty" form:"concurrency"`
+	DryRun      bool `json:"dry-run,omitempty" form:"dry-run"`
+}
+
+// isAdmin reports whether the user may run fleet upgrades.
+func (h *Handler) isAdmin(c *gin.Context) (bool, error) {
+	access, err := h.userAccess(c)
+	if err != nil {
+		return false, err
+	}
+
+	return access.Admin, nil
+}
+
+func (h *Handler) UnleashUpgradeAdminMiddleware(c *gin.Context) {
+	admin, err := h.isAdmin(c)
+	if err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error checking access to fleet upgrades")
+		c.Abort()
+		return
+	}
+
+	if !admin {
+		c.HTML(403, "error.html", gin.H{
+			"title": "Forbidden",
+			"error": "Only platform admins can upgrade the fleet",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// UnleashUpgrade shows the fleet upgrade form, the dry-run plan for the
+// selected filters and the progress of the latest upgrade.
+func (h *Handler) UnleashUpgrade(c *gin.Context) {
+	ctx := c.Request.Context()
+	req := UpgradeRequest{}
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error binding upgrade filters")
+		return
+	}
+
+	var (
+		plan    *unleash.UpgradePlan
+		planErr error
+	)
+	if req.Version != "" {
+		plan, planErr = unleash.PlanUpgrade(ctx, h.unleashService, req.Version, req.UpgradeFilter)
+		if planErr != nil && !errors.As(planErr, new(*unleash.ValidationError)) {
+			_ = c.Error(planErr).
+				SetType(gin.ErrorTypePublic).
+				SetMeta("Error planning upgrade")
+			return
+		}
+	}
+
+	if req.Concurrency == 0 {
+		req.Concurrency = h.config.Unleash.UpgradeConcurrency
+	}
+
+	c.HTML(200, "unleash-upgrade.html", gin.H{
+		"title":           "Upgrade Unleash Instances",
+		"request":         req,
+		"plan":            plan,
+		"planError":       planErr,
+		"run":             h.upgrader.Current(),
+		"unleashVersions": h.unleashVersions(ctx),
+	})
+}
+
+func (h *Handler) UnleashUpgradePost(c *gin.Context) {
+	ctx := c.Request.Context()
+	req := UpgradeRequest{}
+
+	if err := c.ShouldBind(&req); err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error binding upgrade filters")
+		return
+	}
+
+	plan, err := unleash.PlanUpgrade(ctx, h.unleashService, req.Version, req.UpgradeFilter)
+	if err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error planning upgrade")
+		return
+	}
+
+	if _, err := h.upgrader.Start(plan, req.Concurrency); err != nil {
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error starting upgrade, " + err.Error())
+		return
+	}
+
+	h.log(c).Infof("Started upgrade of %d Unleash instances to %s", len(plan.Instances), plan.Version)
+	c.Redirect(302, "/unleash/upgrade")
+}
+
+func (h *Handler) UpgradeApiAdminMiddleware(c *gin.Context) {
+	admin, err := h.isAdmin(c)
+	if err != nil {
+		h.apiError(c, accessErrorStatus(err), err, "Error checking access to fleet upgrades")
+		return
+	}
+
+	if !admin {
+		c.AbortWithStatusJSON(403, ErrorResponse{Error: "Only platform admins can upgrade the fleet"})
+		return
+	}
+
+	c.Next()
+}
+
+// UpgradeApiCreate plans a fleet upgrade and starts it unless it is a dry
+// run, in which case only the plan is returned.
+func (h *Handler) UpgradeApiCreate(c *gin.Context) {
+	ctx := c.Request.Context()
+	req := UpgradeRequest{}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.apiValidationError(c, err)
+		return
+	}
+
+	plan, err := unleash.PlanUpgrade(ctx, h.unleashService, req.Version, req.UpgradeFilter)
+	if err != nil {
+		var validationErr *unleash.ValidationError
+		if errors.As(err, &validationErr) {
+			h.apiValidationError(c, validationErr)
+			return
+		}
+
+		h.apiError(c, 500, err, "Error planning upgrade")
+		return
+	}
+
+	if req.DryRun {
+		c.JSON(200, plan)
+		return
+	}
+
+	run, err := h.upgrader.Start(plan, req.Concurrency)
+	if errors.Is(err, unleash.ErrUpgradeInProgress) {
+		c.AbortWithStatusJSON(409, ErrorResponse{Error: "An upgrade is already in progress"})
+		return
+	} else if errors.Is(err, unleash.ErrUpgraderStopped) {
+		c.AbortWithStatusJSON(503, ErrorResponse{Error: "The server is shutting down"})
+		return
+	} else if err != nil {
+		h.apiError(c, 500, err, "Error starting upgrade")
+		return
+	}
+
+	h.log(c).Infof("Started upgrade of %d Unleash instances to %s", len(plan.Instances), plan.Version)
+	c.JSON(202, run)
+}
+
+// UpgradeApiCurrent returns the progress of the latest fleet upgrade.
+func (h *Handler) UpgradeApiCurrent(c *gin.Context) {
+	run := h.upgrader.Current()
+	if run == nil {
+		c.AbortWithStatusJSON(404, ErrorResponse{Error: "No upgrade has been started"})
+		return
+	}
+
+	c.JSON(200, run)
+}
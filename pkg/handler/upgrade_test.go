@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/iap"
+	"github.com/nais/bifrost/pkg/teams"
+	"github.com/nais/bifrost/pkg/unleash"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUpgradeTestRouter(c *config.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	newInstance := func(name, customVersion, version string) *unleash.UnleashInstance {
+		server := unleash.UnleashDefinition(c, &unleash.UnleashConfig{Name: name, CustomVersion: customVersion})
+		server.Status.Version = version
+		return unleash.NewUnleashInstance(&server)
+	}
+
+	service := &fakeUnleashService{instances: []*unleash.UnleashInstance{
+		newInstance("team-a", "v5.9.0-20240201-090000-aaaaaaa", "5.9.0"),
+		newInstance("team-b", "", "5.11.0"),
+	}}
+
+	authorizer := teams.NewAuthorizer(fakeTeamsClient{
+		"a@example.com":     {"team-a"},
+		"admin@example.com": {"platform"},
+	}, []string{"platform"})
+
+	h := NewHandler(c, logrus.New(), service, nil, nil, nil, authorizer, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Request = c.Request.WithContext(iap.WithUser(c.Request.Context(), user))
+		}
+	})
+	router.POST("/api/v1/upgrades", h.UpgradeApiAdminMiddleware, h.UpgradeApiCreate)
+	router.GET("/api/v1/upgrades/current", h.UpgradeApiAdminMiddleware, h.UpgradeApiCurrent)
+
+	return router
+}
+
+func TestUpgradeApi(t *testing.T) {
+	router := newUpgradeTestRouter(&config.Config{})
+
+	do := func(method, path, user, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", user)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/v1/upgrades", "a@example.com", `{"version":"v5.10.2-20240329-070801-0180a96","dry-run":true}`)
+	assert.Equal(t, 403, w.Code)
+
+	w = do("POST", "/api/v1/upgrades", "admin@example.com", `{"version":"v5.10.2-20240329-070801-0180a96","older-than":"5.10.0","dry-run":true}`)
+	assert.Equal(t, 200, w.Code)
+
+	var plan unleash.UpgradePlan
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Equal(t, "v5.10.2-20240329-070801-0180a96", plan.Version)
+	assert.Equal(t, "5.10.0", plan.Filter.OlderThan)
+	assert.Equal(t, []unleash.PlannedUpgrade{{
+		Name:        "team-a",
+		FromVersion: "5.9.0",
+		FromImage:   "europe-north1-docker.pkg.dev/nais-io/nais/images/unleash-v4:v5.9.0-20240201-090000-aaaaaaa",
+	}}, plan.Instances)
+
+	w = do("POST", "/api/v1/upgrades", "admin@example.com", `{"version":"v5.10.2-20240329-070801-0180a96","name-pattern":"[","dry-run":true}`)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "NamePattern")
+
+	w = do("GET", "/api/v1/upgrades/current", "admin@example.com", "")
+	assert.Equal(t, 404, w.Code)
+}
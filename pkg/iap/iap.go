@@ -0,0 +1,184 @@
+package iap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AssertionHeader = "x-goog-iap-jwt-assertion"
+	Issuer          = "https://cloud.google.com/iap"
+
+	clockSkew = 30 * time.Second
+)
+
+type contextKey string
+
+const userContextKey contextKey = "iap-user"
+
+// Claims are the claims of an IAP JWT assertion that bifrost cares about.
+type Claims struct {
+	Email        string `json:"email"`
+	Subject      string `json:"sub"`
+	Audience     string `json:"aud"`
+	Issuer       string `json:"iss"`
+	HostedDomain string `json:"hd"`
+	ExpiresAt    int64  `json:"exp"`
+	IssuedAt     int64  `json:"iat"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Validator validates JWT assertions signed by Google Identity-Aware Proxy.
+type Validator struct {
+	audience string
+	keys     KeySource
+	now      func() time.Time
+}
+
+func NewValidator(audience string, keys KeySource) *Validator {
+	return &Validator{
+		audience: audience,
+		keys:     keys,
+		now:      time.Now,
+	}
+}
+
+// Validate checks the signature, audience, issuer and expiry of the token and
+// returns its claims.
+func (v *Validator) Validate(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	if h.Alg != "ES256" {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", h.Alg)
+	}
+
+	key, err := v.keys.Key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(key, parts[0]+"."+parts[1], parts[2]); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	now := v.now()
+
+	if claims.Audience != v.audience {
+		return nil, fmt.Errorf("invalid audience: %s", claims.Audience)
+	}
+
+	if claims.Issuer != Issuer {
+		return nil, fmt.Errorf("invalid issuer: %s", claims.Issuer)
+	}
+
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, errors.New("token has expired")
+	}
+
+	if now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, errors.New("token is issued in the future")
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New("token has no email")
+	}
+
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func verifySignature(key *ecdsa.PublicKey, signed, signature string) error {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid token signature: %w", err)
+	}
+
+	if len(sig) != 64 {
+		return errors.New("invalid token signature length")
+	}
+
+	hash := sha256.Sum256([]byte(signed))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+
+	if !ecdsa.Verify(key, hash[:], r, s) {
+		return errors.New("invalid token signature")
+	}
+
+	return nil
+}
+
+// Middleware rejects requests without a valid IAP assertion and stores the
+// authenticated user's email in both the gin and the request context, where
+// it is also added to the request logger.
+func Middleware(v *Validator, logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(AssertionHeader)
+		if token == "" {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Missing IAP assertion"})
+			return
+		}
+
+		claims, err := v.Validate(c.Request.Context(), token)
+		if err != nil {
+			logging.FromContext(logging.WithDefault(c.Request.Context(), logger)).WithError(err).Warn("Rejected request with invalid IAP assertion")
+			c.AbortWithStatusJSON(401, gin.H{"error": "Invalid IAP assertion"})
+			return
+		}
+
+		ctx := WithUser(c.Request.Context(), claims.Email)
+		ctx = logging.WithFields(ctx, logrus.Fields{"user": claims.Email})
+
+		c.Set("user", claims.Email)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// WithUser returns a copy of ctx carrying the authenticated user's email.
+func WithUser(ctx context.Context, email string) context.Context {
+	return context.WithValue(ctx, userContextKey, email)
+}
+
+// UserFromContext returns the authenticated user's email, if any.
+func UserFromContext(ctx context.Context) (string, bool) {
+	email, ok := ctx.Value(userContextKey).(string)
+	return email, ok && email != ""
+}
@@ -0,0 +1,278 @@
+package iap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAudience = "/projects/123/global/backendServices/456"
+
+type testKeySet struct {
+	keys     map[string]*ecdsa.PrivateKey
+	server   *httptest.Server
+	requests atomic.Int32
+	fail     atomic.Bool
+}
+
+func newTestKeySet(t *testing.T, kids ...string) *testKeySet {
+	ks := &testKeySet{keys: map[string]*ecdsa.PrivateKey{}}
+
+	set := jwkSet{}
+	for _, kid := range kids {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		ks.keys[kid] = key
+
+		set.Keys = append(set.Keys, jwk{
+			Kid: kid,
+			Kty: "EC",
+			Crv: "P-256",
+			Alg: "ES256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+
+	ks.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ks.requests.Add(1)
+		if ks.fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(set))
+	}))
+	t.Cleanup(ks.server.Close)
+
+	return ks
+}
+
+func (ks *testKeySet) sign(t *testing.T, kid string, claims Claims) string {
+	h, err := json.Marshal(header{Alg: "ES256", Kid: kid})
+	assert.NoError(t, err)
+	c, err := json.Marshal(claims)
+	assert.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	hash := sha256.Sum256([]byte(signed))
+
+	r, s, err := ecdsa.Sign(rand.Reader, ks.keys[kid], hash[:])
+	assert.NoError(t, err)
+
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() Claims {
+	return Claims{
+		Email:     "user@example.com",
+		Subject:   "accounts.google.com:123",
+		Audience:  testAudience,
+		Issuer:    Issuer,
+		ExpiresAt: time.Now().Add(10 * time.Minute).Unix(),
+		IssuedAt:  time.Now().Unix(),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ks := newTestKeySet(t, "key-1", "key-2")
+	other := newTestKeySet(t, "key-1")
+	v := NewValidator(testAudience, NewJWKKeySource(ks.server.URL, nil))
+	ctx := context.Background()
+
+	testCases := []struct {
+		name    string
+		token   func() string
+		wantErr string
+	}{
+		{
+			name:  "valid token",
+			token: func() string { return ks.sign(t, "key-1", validClaims()) },
+		},
+		{
+			name:  "valid token signed with second key",
+			token: func() string { return ks.sign(t, "key-2", validClaims()) },
+		},
+		{
+			name:    "malformed token",
+			token:   func() string { return "foo.bar" },
+			wantErr: "malformed token",
+		},
+		{
+			name:    "signed with unknown key",
+			token:   func() string { return other.sign(t, "key-1", validClaims()) },
+			wantErr: "invalid token signature",
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := validClaims()
+				claims.Audience = "/projects/123/global/backendServices/789"
+				return ks.sign(t, "key-1", claims)
+			},
+			wantErr: "invalid audience: /projects/123/global/backendServices/789",
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := validClaims()
+				claims.Issuer = "https://example.com"
+				return ks.sign(t, "key-1", claims)
+			},
+			wantErr: "invalid issuer: https://example.com",
+		},
+		{
+			name: "expired token",
+			token: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = time.Now().Add(-10 * time.Minute).Unix()
+				return ks.sign(t, "key-1", claims)
+			},
+			wantErr: "token has expired",
+		},
+		{
+			name: "missing email",
+			token: func() string {
+				claims := validClaims()
+				claims.Email = ""
+				return ks.sign(t, "key-1", claims)
+			},
+			wantErr: "token has no email",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := v.Validate(ctx, tc.token())
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				assert.Nil(t, claims)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "user@example.com", claims.Email)
+			}
+		})
+	}
+}
+
+func TestValidateUnknownKeyID(t *testing.T) {
+	ks := newTestKeySet(t, "key-1")
+	other := newTestKeySet(t, "key-3")
+	v := NewValidator(testAudience, NewJWKKeySource(ks.server.URL, nil))
+
+	_, err := v.Validate(context.Background(), other.sign(t, "key-3", validClaims()))
+	assert.EqualError(t, err, "unknown key id: key-3")
+}
+
+func TestJWKKeySourceRefetchFailure(t *testing.T) {
+	ks := newTestKeySet(t, "key-1")
+	source := NewJWKKeySource(ks.server.URL, nil)
+	ctx := context.Background()
+
+	_, err := source.Key(ctx, "key-1")
+	assert.NoError(t, err)
+
+	// The cached keys are served while the keys can not be refetched
+	ks.fail.Store(true)
+	source.fetchedAt = time.Now().Add(-2 * keysTTL)
+	source.attemptedAt = source.fetchedAt
+
+	key, err := source.Key(ctx, "key-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+	assert.Equal(t, int32(2), ks.requests.Load())
+
+	// Failed refetches are not retried on every request
+	_, err = source.Key(ctx, "key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), ks.requests.Load())
+
+	ks.fail.Store(false)
+	source.attemptedAt = time.Now().Add(-2 * keysMinRefreshInterval)
+
+	_, err = source.Key(ctx, "key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), ks.requests.Load())
+	assert.WithinDuration(t, time.Now(), source.fetchedAt, time.Minute)
+}
+
+func TestJWKKeySourceUnavailable(t *testing.T) {
+	ks := newTestKeySet(t, "key-1")
+	ks.fail.Store(true)
+	source := NewJWKKeySource(ks.server.URL, nil)
+
+	_, err := source.Key(context.Background(), "key-1")
+	assert.EqualError(t, err, "unexpected status code fetching keys: 503")
+
+	// Without cached keys every request retries
+	ks.fail.Store(false)
+	_, err = source.Key(context.Background(), "key-1")
+	assert.NoError(t, err)
+}
+
+func TestJWKKeySourceConcurrentFetch(t *testing.T) {
+	ks := newTestKeySet(t, "key-1")
+	source := NewJWKKeySource(ks.server.URL, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := source.Key(context.Background(), "key-1")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Less(t, ks.requests.Load(), int32(20))
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ks := newTestKeySet(t, "key-1")
+	v := NewValidator(testAudience, NewJWKKeySource(ks.server.URL, nil))
+
+	router := gin.New()
+	router.Use(Middleware(v, logrus.New()))
+	router.GET("/", func(c *gin.Context) {
+		user, _ := UserFromContext(c.Request.Context())
+		c.String(200, "%s %s", user, c.GetString("user"))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"error":"Missing IAP assertion"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set(AssertionHeader, "foo.bar.baz")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"error":"Invalid IAP assertion"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set(AssertionHeader, ks.sign(t, "key-1", validClaims()))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "user@example.com user@example.com", w.Body.String())
+}
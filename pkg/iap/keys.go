@@ -0,0 +1,178 @@
+package iap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	keysTTL                = 1 * time.Hour
+	keysMinRefreshInterval = 1 * time.Minute
+	keysFetchTimeout       = 10 * time.Second
+)
+
+// KeySource returns the public key used to sign tokens with the given key ID.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (*ecdsa.PublicKey, error)
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Alg string `json:"alg"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// JWKKeySource fetches keys from a JSON Web Key Set and caches them in memory.
+// Keys are refetched when they expire or when an unknown key ID is requested.
+// If a refetch fails, the cached keys are used until a later refetch succeeds.
+type JWKKeySource struct {
+	url        string
+	httpClient *http.Client
+	fetches    singleflight.Group
+
+	mu          sync.Mutex
+	keys        map[string]*ecdsa.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func NewJWKKeySource(url string, httpClient *http.Client) *JWKKeySource {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &JWKKeySource{
+		url:        url,
+		httpClient: httpClient,
+		keys:       map[string]*ecdsa.PublicKey{},
+	}
+}
+
+func (s *JWKKeySource) Key(ctx context.Context, kid string) (*ecdsa.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	expired := time.Since(s.fetchedAt) > keysTTL
+	// Without any keys every request fails, so fetching is only throttled
+	// once there are keys to serve
+	throttled := len(s.keys) > 0 && time.Since(s.attemptedAt) < keysMinRefreshInterval
+	s.mu.Unlock()
+
+	if (expired || !ok) && !throttled {
+		keys, err := s.refresh(ctx)
+		if err != nil && !ok {
+			return nil, err
+		}
+		if err == nil {
+			key, ok = keys[kid]
+		}
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	return key, nil
+}
+
+// refresh refetches the keys, sharing a single fetch between concurrent
+// callers. The lock is not held while fetching, so requests signed with a
+// cached key are not held up.
+func (s *JWKKeySource) refresh(ctx context.Context) (map[string]*ecdsa.PublicKey, error) {
+	keys, err, _ := s.fetches.Do("keys", func() (interface{}, error) {
+		// The fetch is shared, so it must not be cancelled with the request
+		// that started it
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), keysFetchTimeout)
+		defer cancel()
+
+		keys, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.attemptedAt = time.Now()
+		if err != nil {
+			return nil, err
+		}
+
+		s.keys = keys
+		s.fetchedAt = s.attemptedAt
+		return keys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys.(map[string]*ecdsa.PublicKey), nil
+}
+
+func (s *JWKKeySource) fetch(ctx context.Context) (map[string]*ecdsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code fetching keys: %d", resp.StatusCode)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*ecdsa.PublicKey{}
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (*ecdsa.PublicKey, error) {
+	if k.Kty != "EC" || k.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported key type %s/%s for key id %s", k.Kty, k.Crv, k.Kid)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate for key id %s: %w", k.Kid, err)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate for key id %s: %w", k.Kid, err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
@@ -0,0 +1,192 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats for BIFROST_LOG_FORMAT.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// RequestIDHeader is the header identifying a request across services.
+const RequestIDHeader = "X-Request-ID"
+
+// New creates a logger writing to stdout with the given level, e.g. "info",
+// and format.
+func New(level, format string) (*logrus.Logger, error) {
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	logger.SetLevel(lvl)
+
+	switch format {
+	case FormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+		})
+	case FormatText:
+		logger.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be %s or %s", format, FormatJSON, FormatText)
+	}
+
+	return logger, nil
+}
+
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	requestIDContextKey
+)
+
+// NewContext returns a copy of ctx carrying entry.
+func NewContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerContextKey, entry)
+}
+
+// FromContext returns the logger carried by ctx, or the standard logger if
+// there is none.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerContextKey).(*logrus.Entry); ok {
+		return entry.WithContext(ctx)
+	}
+	return logrus.NewEntry(logrus.StandardLogger()).WithContext(ctx)
+}
+
+// WithDefault returns a copy of ctx carrying logger, unless ctx already
+// carries a logger, e.g. one for the current request.
+func WithDefault(ctx context.Context, logger *logrus.Logger) context.Context {
+	if _, ok := ctx.Value(loggerContextKey).(*logrus.Entry); ok || logger == nil {
+		return ctx
+	}
+	return NewContext(ctx, logrus.NewEntry(logger))
+}
+
+// WithFields returns a copy of ctx whose logger includes fields.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return NewContext(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// RequestIDFromContext returns the ID of the request ctx belongs to, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// validRequestID matches request IDs that are safe to log and return.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]{1,128}$`)
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID assigns every request an ID, keeping a valid ID set by the
+// client or load balancer in X-Request-ID. The ID is returned in the
+// response header and added to a logger for the request, which is stored in
+// the request context. The logger also carries the trace ID if the request is
+// traced.
+func RequestID(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Header(RequestIDHeader, id)
+
+		fields := logrus.Fields{"request_id": id}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.HasTraceID() {
+			fields["trace_id"] = span.TraceID().String()
+		}
+
+		ctx := context.WithValue(c.Request.Context(), requestIDContextKey, id)
+		ctx = NewContext(ctx, logger.WithFields(fields))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// quietPaths are polled by Kubernetes and Prometheus and only logged at debug
+// level.
+var quietPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// IsQuietPath reports whether path is polled by Kubernetes or Prometheus.
+func IsQuietPath(path string) bool {
+	return quietPaths[path]
+}
+
+// Middleware logs every request once it has been served, with the logger of
+// the request if RequestID runs before it. Server errors are
+// logged as errors and client errors as warnings.
+func Middleware(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// The request logger carries fields added while serving the request,
+		// such as the instance name
+		status := c.Writer.Status()
+		entry := FromContext(WithDefault(c.Request.Context(), logger)).WithFields(logrus.Fields{
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"route":      c.FullPath(),
+			"status":     status,
+			"latency_ms": time.Since(start).Milliseconds(),
+			"size":       c.Writer.Size(),
+			"user":       c.GetString("user"),
+			"client_ip":  c.ClientIP(),
+		})
+
+		msg := fmt.Sprintf("%s %s %d", c.Request.Method, c.Request.URL.Path, status)
+		switch {
+		case status >= 500:
+			entry.Error(msg)
+		case status >= 400:
+			entry.Warn(msg)
+		case IsQuietPath(c.Request.URL.Path):
+			entry.Debug(msg)
+		default:
+			entry.Info(msg)
+		}
+	}
+}
+
+// Recovery responds with 500 Internal Server Error when a handler panics and
+// logs the panic with its stack trace.
+func Recovery(logger *logrus.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		FromContext(WithDefault(c.Request.Context(), logger)).WithFields(logrus.Fields{
+			"panic": fmt.Sprint(err),
+			"stack": string(debug.Stack()),
+		}).Errorf("Panic serving %s %s", c.Request.Method, c.Request.URL.Path)
+		c.AbortWithStatus(500)
+	})
+}
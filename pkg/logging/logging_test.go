@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		level, format string
+		expected      logrus.Level
+		formatter     logrus.Formatter
+		err           string
+	}{
+		{level: "info", format: FormatJSON, expected: logrus.InfoLevel, formatter: &logrus.JSONFormatter{}},
+		{level: "debug", format: FormatText, expected: logrus.DebugLevel, formatter: &logrus.TextFormatter{}},
+		{level: "verbose", format: FormatJSON, err: `invalid log level "verbose"`},
+		{level: "info", format: "xml", err: `invalid log format "xml", must be json or text`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level+"/"+tt.format, func(t *testing.T) {
+			logger, err := New(tt.level, tt.format)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, logger.GetLevel())
+			assert.IsType(t, tt.formatter, logger.Formatter)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+
+	router := gin.New()
+	router.Use(RequestID(logger), Middleware(logger), Recovery(logger))
+	router.Use(func(c *gin.Context) {
+		c.Set("user", "user@example.com")
+		c.Request = c.Request.WithContext(WithFields(c.Request.Context(), logrus.Fields{"instance": "team-a"}))
+	})
+	router.GET("/unleash/:id/", func(c *gin.Context) {
+		c.String(200, "OK")
+	})
+	router.GET("/healthz", func(c *gin.Context) {
+		c.String(200, "OK")
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		level  logrus.Level
+	}{
+		{path: "/unleash/team-a/", status: 200, level: logrus.InfoLevel},
+		{path: "/healthz", status: 200, level: logrus.DebugLevel},
+		{path: "/does-not-exist", status: 404, level: logrus.WarnLevel},
+		{path: "/panic", status: 500, level: logrus.ErrorLevel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			hook.Reset()
+
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			req.Header.Set(RequestIDHeader, "abc123")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+
+			entry := hook.LastEntry()
+			if !assert.NotNil(t, entry) {
+				return
+			}
+			assert.Equal(t, tt.level, entry.Level)
+			assert.Equal(t, "GET", entry.Data["method"])
+			assert.Equal(t, tt.path, entry.Data["path"])
+			assert.Equal(t, tt.status, entry.Data["status"])
+			assert.Equal(t, "user@example.com", entry.Data["user"])
+			assert.Equal(t, "abc123", entry.Data["request_id"])
+			assert.Equal(t, "team-a", entry.Data["instance"])
+			assert.Contains(t, entry.Data, "latency_ms")
+		})
+	}
+
+	// The panic is logged before the request
+	assert.Len(t, hook.Entries, 2)
+	assert.Equal(t, "boom", hook.Entries[0].Data["panic"])
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger, hook := test.NewNullLogger()
+
+	router := gin.New()
+	router.Use(RequestID(logger))
+	router.GET("/", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		FromContext(ctx).Info("Serving request")
+		c.String(200, RequestIDFromContext(ctx))
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "propagated", header: "abc-123", keep: true},
+		{name: "missing", header: ""},
+		{name: "invalid", header: "abc 123\n"},
+		{name: "too long", header: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook.Reset()
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.keep {
+				assert.Equal(t, tt.header, id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+			assert.Equal(t, id, w.Body.String())
+			assert.Equal(t, id, hook.LastEntry().Data["request_id"])
+		})
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	other, otherHook := test.NewNullLogger()
+
+	ctx := WithDefault(context.Background(), logger)
+	ctx = WithFields(ctx, logrus.Fields{"user": "user@example.com"})
+	ctx = WithFields(ctx, logrus.Fields{"instance": "team-a"})
+
+	// A logger already in the context is kept
+	ctx = WithDefault(ctx, other)
+
+	FromContext(ctx).Info("Creating instance")
+	assert.Empty(t, otherHook.Entries)
+	assert.Equal(t, logrus.Fields{"user": "user@example.com", "instance": "team-a"}, hook.LastEntry().Data)
+	assert.Equal(t, ctx, hook.LastEntry().Context)
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bifrost"
+
+// Outcomes of a provisioning step.
+const (
+	OutcomeSuccess        = "success"
+	OutcomeFailure        = "failure"
+	OutcomeRolledBack     = "rolled_back"
+	OutcomeRollbackFailed = "rollback_failed"
+)
+
+// Registry holds all metrics exposed on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	provisionStepsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provision_steps_total",
+		Help:      "Number of Unleash provisioning steps by step and outcome.",
+	}, []string{"step", "outcome"})
+
+	provisionStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provision_step_duration_seconds",
+		Help:      "Duration of Unleash provisioning steps by step and outcome.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"step", "outcome"})
+)
+
+// fleet exports the state of every Unleash instance. The instances are
+// replaced as a whole and read once per scrape, so a scrape never sees a
+// partially updated fleet.
+var fleet = &fleetCollector{
+	ready: prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unleash_instance_ready"),
+		"Whether the Unleash instance is ready (1) or not (0).",
+		[]string{"name"}, nil,
+	),
+	info: prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unleash_instance_info"),
+		"Version and image of the Unleash instance, always 1.",
+		[]string{"name", "version", "custom_image"}, nil,
+	),
+	federationEnabled: prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unleash_instance_federation_enabled"),
+		"Whether federation is enabled (1) or not (0) for the Unleash instance.",
+		[]string{"name"}, nil,
+	),
+	databasePoolMax: prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unleash_instance_database_pool_max"),
+		"Configured maximum database pool size of the Unleash instance.",
+		[]string{"name"}, nil,
+	),
+}
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		provisionStepsTotal,
+		provisionStepDuration,
+		fleet,
+	)
+}
+
+// Handler serves the metrics in Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Middleware counts requests and observes their latency. Requests are
+// labelled by route template rather than path to keep cardinality bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveProvisionStep records the outcome of running a provisioning step.
+func ObserveProvisionStep(step, outcome string, duration time.Duration) {
+	provisionStepsTotal.WithLabelValues(step, outcome).Inc()
+	provisionStepDuration.WithLabelValues(step, outcome).Observe(duration.Seconds())
+}
+
+// CountProvisionStep records an outcome of a provisioning step without a
+// duration, such as the result of rolling it back.
+func CountProvisionStep(step, outcome string) {
+	provisionStepsTotal.WithLabelValues(step, outcome).Inc()
+}
+
+// FleetInstance is the state of a single Unleash instance exported as fleet
+// gauges.
+type FleetInstance struct {
+	Name              string
+	Version           string
+	CustomImage       string
+	Ready             bool
+	FederationEnabled bool
+	DatabasePoolMax   int
+}
+
+// SetFleet replaces the fleet gauges with the given instances, so that
+// deleted instances stop being reported.
+func SetFleet(instances []FleetInstance) {
+	fleet.mu.Lock()
+	defer fleet.mu.Unlock()
+
+	fleet.instances = instances
+}
+
+type fleetCollector struct {
+	ready             *prometheus.Desc
+	info              *prometheus.Desc
+	federationEnabled *prometheus.Desc
+	databasePoolMax   *prometheus.Desc
+
+	mu        sync.RWMutex
+	instances []FleetInstance
+}
+
+func (f *fleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.ready
+	ch <- f.info
+	ch <- f.federationEnabled
+	ch <- f.databasePoolMax
+}
+
+func (f *fleetCollector) Collect(ch chan<- prometheus.Metric) {
+	f.mu.RLock()
+	instances := f.instances
+	f.mu.RUnlock()
+
+	for _, instance := range instances {
+		ch <- prometheus.MustNewConstMetric(f.ready, prometheus.GaugeValue, boolToFloat(instance.Ready), instance.Name)
+		ch <- prometheus.MustNewConstMetric(f.info, prometheus.GaugeValue, 1, instance.Name, instance.Version, instance.CustomImage)
+		ch <- prometheus.MustNewConstMetric(f.federationEnabled, prometheus.GaugeValue, boolToFloat(instance.FederationEnabled), instance.Name)
+		ch <- prometheus.MustNewConstMetric(f.databasePoolMax, prometheus.GaugeValue, float64(instance.DatabasePoolMax), instance.Name)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/unleash/:id/", func(c *gin.Context) {
+		c.String(200, "OK")
+	})
+
+	for _, path := range []string{"/unleash/a/", "/unleash/b/", "/does-not-exist"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "/unleash/:id/", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "unmatched", "404")))
+}
+
+func TestProvisionStepMetrics(t *testing.T) {
+	ObserveProvisionStep("test step", OutcomeSuccess, time.Second)
+	ObserveProvisionStep("test step", OutcomeFailure, time.Second)
+	CountProvisionStep("test step", OutcomeRolledBack)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(provisionStepsTotal.WithLabelValues("test step", OutcomeSuccess)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(provisionStepsTotal.WithLabelValues("test step", OutcomeFailure)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(provisionStepsTotal.WithLabelValues("test step", OutcomeRolledBack)))
+	assert.Equal(t, 2, testutil.CollectAndCount(provisionStepDuration))
+}
+
+func TestSetFleet(t *testing.T) {
+	SetFleet([]FleetInstance{{Name: "a", Ready: true}, {Name: "b"}})
+	assert.Equal(t, 8, testutil.CollectAndCount(fleet))
+
+	// Deleted instances are no longer reported
+	SetFleet([]FleetInstance{{Name: "a", Ready: true}})
+	assert.Equal(t, 4, testutil.CollectAndCount(fleet))
+	assert.Equal(t, 1, testutil.CollectAndCount(fleet, "bifrost_unleash_instance_ready"))
+}
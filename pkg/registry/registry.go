@@ -0,0 +1,362 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nais/bifrost/pkg/github"
+)
+
+const maxTagPages = 10
+
+// ErrManifestNotFound is returned when an image reference does not exist.
+var ErrManifestNotFound = errors.New("manifest not found")
+
+// tagPattern is the grammar for image tags from the OCI distribution spec.
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+// ValidTag reports whether tag is a valid image tag, so it can be put in a
+// manifest URL.
+func ValidTag(tag string) bool {
+	return tagPattern.MatchString(tag)
+}
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code from registry: %d", e.code)
+}
+
+type cachedTags struct {
+	tags      []string
+	fetchedAt time.Time
+}
+
+type bearerToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// Client lists image tags using the Docker Registry HTTP API V2. Anonymous
+// bearer tokens are requested when the registry asks for them. Tags are cached
+// for the configured TTL, and the last successful result is returned when the
+// registry cannot be reached. Locks are only held to read and write the caches,
+// not during requests.
+type Client struct {
+	registryUrl string
+	ttl         time.Duration
+	httpClient  *http.Client
+	now         func() time.Time
+
+	mu   sync.Mutex
+	tags map[string]cachedTags
+
+	tokensMu sync.Mutex
+	tokens   map[string]bearerToken
+}
+
+func NewClient(registryUrl string, ttl time.Duration, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		registryUrl: strings.TrimSuffix(registryUrl, "/"),
+		ttl:         ttl,
+		httpClient:  httpClient,
+		now:         time.Now,
+		tags:        map[string]cachedTags{},
+		tokens:      map[string]bearerToken{},
+	}
+}
+
+// Tags returns the tags of the repository, e.g. "nais-io/nais/images/unleash-v4".
+func (c *Client) Tags(ctx context.Context, repository string) ([]string, error) {
+	c.mu.Lock()
+	cached, ok := c.tags[repository]
+	c.mu.Unlock()
+
+	if ok && c.now().Sub(cached.fetchedAt) < c.ttl {
+		return cached.tags, nil
+	}
+
+	tags, err := c.fetchTags(ctx, repository)
+	if err != nil {
+		if ok {
+			return cached.tags, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.tags[repository] = cachedTags{tags: tags, fetchedAt: c.now()}
+	c.mu.Unlock()
+
+	return tags, nil
+}
+
+func (c *Client) fetchTags(ctx context.Context, repository string) ([]string, error) {
+	next := fmt.Sprintf("%s/v2/%s/tags/list", c.registryUrl, repository)
+	tags := []string{}
+
+	for i := 0; next != "" && i < maxTagPages; i++ {
+		resp, err := c.get(ctx, repository, next)
+		if err != nil {
+			return nil, err
+		}
+
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		link := resp.Header.Get("Link")
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, list.Tags...)
+
+		next, err = c.nextPageUrl(next, link)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// get requests url, authenticating with a bearer token if the registry
+// responds with a challenge.
+func (c *Client) get(ctx context.Context, repository, url string) (*http.Response, error) {
+	return c.request(ctx, http.MethodGet, repository, url, nil)
+}
+
+func (c *Client) request(ctx context.Context, method, repository, url string, header http.Header) (*http.Response, error) {
+	c.tokensMu.Lock()
+	token := c.tokens[repository].valid(c.now())
+	c.tokensMu.Unlock()
+
+	resp, err := c.do(ctx, method, url, token, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		token, err := c.fetchToken(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		c.tokensMu.Lock()
+		c.tokens[repository] = token
+		c.tokensMu.Unlock()
+
+		resp, err = c.do(ctx, method, url, token.token, header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &statusError{code: resp.StatusCode}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) do(ctx context.Context, method, url, token string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// Digest returns the digest of the manifest that reference, a tag or digest,
+// points to in the repository. ErrManifestNotFound is returned if there is no
+// such manifest.
+func (c *Client) Digest(ctx context.Context, repository, reference string) (string, error) {
+	header := http.Header{"Accept": manifestMediaTypes}
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.registryUrl, repository, reference)
+
+	resp, err := c.request(ctx, http.MethodHead, repository, url, header)
+	if err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+			return "", ErrManifestNotFound
+		}
+		return "", err
+	}
+	resp.Body.Close()
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry returned no digest for %s:%s", repository, reference)
+	}
+
+	return digest, nil
+}
+
+var challengeParamPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func (c *Client) fetchToken(ctx context.Context, challenge string) (bearerToken, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return bearerToken{}, errors.New("registry requires unsupported authentication")
+	}
+
+	params := map[string]string{}
+	for _, match := range challengeParamPattern.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+
+	if params["realm"] == "" {
+		return bearerToken{}, errors.New("registry authentication challenge has no realm")
+	}
+
+	tokenUrl, err := url.Parse(params["realm"])
+	if err != nil {
+		return bearerToken{}, err
+	}
+
+	query := tokenUrl.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	tokenUrl.RawQuery = query.Encode()
+
+	resp, err := c.do(ctx, http.MethodGet, tokenUrl.String(), "", nil)
+	if err != nil {
+		return bearerToken{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return bearerToken{}, fmt.Errorf("unexpected status code from registry token endpoint: %d", resp.StatusCode)
+	}
+
+	var res struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return bearerToken{}, err
+	}
+
+	token := res.Token
+	if token == "" {
+		token = res.AccessToken
+	}
+
+	// Tokens without an expiry are valid for at least 60 seconds.
+	expiresIn := res.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = 60
+	}
+
+	return bearerToken{token: token, expiresAt: c.now().Add(time.Duration(expiresIn) * time.Second)}, nil
+}
+
+func (t bearerToken) valid(now time.Time) string {
+	if now.Before(t.expiresAt) {
+		return t.token
+	}
+
+	return ""
+}
+
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPageUrl resolves the next page from the Link header, which registries
+// usually return relative to the registry.
+func (c *Client) nextPageUrl(current, link string) (string, error) {
+	match := linkNextPattern.FindStringSubmatch(link)
+	if match == nil {
+		return "", nil
+	}
+
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+
+	next, err := base.Parse(match[1])
+	if err != nil {
+		return "", err
+	}
+
+	return next.String(), nil
+}
+
+// VersionProvider lists the Unleash versions that have an image in the
+// repository.
+type VersionProvider struct {
+	client     *Client
+	repository string
+}
+
+func NewVersionProvider(client *Client, repository string) *VersionProvider {
+	return &VersionProvider{
+		client:     client,
+		repository: repository,
+	}
+}
+
+func (p *VersionProvider) UnleashVersions(ctx context.Context) ([]github.UnleashVersion, error) {
+	tags, err := p.client.Tags(ctx, p.repository)
+	if err != nil {
+		return nil, err
+	}
+
+	return github.UnleashVersionsFromTags(tags), nil
+}
+
+// ImageResolver resolves tags of a single image repository to digests.
+type ImageResolver struct {
+	client     *Client
+	repository string
+}
+
+func NewImageResolver(client *Client, repository string) *ImageResolver {
+	return &ImageResolver{
+		client:     client,
+		repository: repository,
+	}
+}
+
+func (r *ImageResolver) Digest(ctx context.Context, tag string) (string, error) {
+	return r.client.Digest(ctx, r.repository, tag)
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRegistry returns a registry stand-in that requires an anonymous
+// bearer token and pages its tags two at a time.
+func newTestRegistry(t *testing.T, tags []string) (*httptest.Server, *int) {
+	requests := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		switch r.URL.Path {
+		case "/token":
+			assert.Equal(t, "registry.test", r.URL.Query().Get("service"))
+			assert.Equal(t, "repository:my/repo:pull", r.URL.Query().Get("scope"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"token": "anonymous", "expires_in": 300})
+		case "/v2/my/repo/tags/list":
+			if r.Header.Get("Authorization") != "Bearer anonymous" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry.test",scope="repository:my/repo:pull"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			start := 0
+			if last := r.URL.Query().Get("last"); last != "" {
+				for i, tag := range tags {
+					if tag == last {
+						start = i + 1
+					}
+				}
+			}
+
+			end := start + 2
+			if end < len(tags) {
+				w.Header().Set("Link", `</v2/my/repo/tags/list?n=2&last=`+tags[end-1]+`>; rel="next"`)
+			} else {
+				end = len(tags)
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "my/repo", "tags": tags[start:end]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestTags(t *testing.T) {
+	tags := []string{"latest", "v5.10.2-20240329-070801-0180a96", "v5.10.1-20240301-070801-1234567", "v5.9.0-20240201-070801-abcdefg", "main"}
+	server, requests := newTestRegistry(t, tags)
+
+	client := NewClient(server.URL, time.Minute, nil)
+	ctx := context.Background()
+
+	got, err := client.Tags(ctx, "my/repo")
+	assert.NoError(t, err)
+	assert.Equal(t, tags, got)
+	// Challenge, token and three pages.
+	assert.Equal(t, 5, *requests)
+
+	got, err = client.Tags(ctx, "my/repo")
+	assert.NoError(t, err)
+	assert.Equal(t, tags, got)
+	assert.Equal(t, 5, *requests)
+
+	_, err = client.Tags(ctx, "other/repo")
+	assert.EqualError(t, err, "unexpected status code from registry: 404")
+}
+
+func TestTagsStale(t *testing.T) {
+	server, _ := newTestRegistry(t, []string{"v5.10.2-20240329-070801-0180a96"})
+
+	client := NewClient(server.URL, time.Minute, nil)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := client.Tags(ctx, "my/repo")
+	assert.NoError(t, err)
+
+	server.Close()
+	now = now.Add(time.Hour)
+
+	got, err := client.Tags(ctx, "my/repo")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v5.10.2-20240329-070801-0180a96"}, got)
+}
+
+func TestTagsDoNotWaitForOtherFetches(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/my/slow/tags/list" {
+			close(started)
+			<-release
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"v1.0.0"}})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, time.Minute, nil)
+	ctx := context.Background()
+
+	_, err := client.Tags(ctx, "my/repo")
+	assert.NoError(t, err)
+
+	go func() { _, _ = client.Tags(ctx, "my/slow") }()
+	<-started
+
+	// Cached tags are returned while another repository is being fetched
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		got, err := client.Tags(ctx, "my/repo")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"v1.0.0"}, got)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cached tags waited for another fetch")
+	}
+}
+
+func TestVersionProvider(t *testing.T) {
+	server, _ := newTestRegistry(t, []string{"latest", "v5.9.0-20240201-070801-abcdefg", "v5.10.2-20240329-070801-0180a96"})
+
+	provider := NewVersionProvider(NewClient(server.URL, time.Minute, nil), "my/repo")
+
+	versions, err := provider.UnleashVersions(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+	assert.Equal(t, "v5.10.2-20240329-070801-0180a96", versions[0].GitTag)
+	assert.Equal(t, "v5.9.0-20240201-070801-abcdefg", versions[1].GitTag)
+}
+
+func TestDigest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		assert.Contains(t, r.Header.Values("Accept"), "application/vnd.oci.image.index.v1+json")
+
+		switch r.URL.Path {
+		case "/v2/my/repo/manifests/v5.10.2-20240329-070801-0180a96":
+			w.Header().Set("Docker-Content-Digest", "sha256:abc123")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	resolver := NewImageResolver(NewClient(server.URL, time.Minute, nil), "my/repo")
+	ctx := context.Background()
+
+	digest, err := resolver.Digest(ctx, "v5.10.2-20240329-070801-0180a96")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:abc123", digest)
+
+	_, err = resolver.Digest(ctx, "v0.0.0-typo")
+	assert.ErrorIs(t, err, ErrManifestNotFound)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+
+	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cachedObjects are the kinds watched by the informer cache. Events are
+// cached as the events timeline of an instance filters all events in the
+// namespace on every render.
+var cachedObjects = []ctrl.Object{
+	&unleashv1.Unleash{},
+	&corev1.Secret{},
+	&fqdnV1alpha3.FQDNNetworkPolicy{},
+	&corev1.Event{},
+}
+
+// cachedClient serves reads of the cached kinds from an informer cache and
+// everything else, including all writes, from the API server.
+type cachedClient struct {
+	ctrl.Client
+	cache ctrl.Reader
+}
+
+func newCachedClient(client ctrl.Client, cache ctrl.Reader) *cachedClient {
+	return &cachedClient{
+		Client: client,
+		cache:  cache,
+	}
+}
+
+func isCached(obj ctrl.Object) bool {
+	switch obj.(type) {
+	case *unleashv1.Unleash, *corev1.Secret, *fqdnV1alpha3.FQDNNetworkPolicy, *corev1.Event:
+		return true
+	}
+	return false
+}
+
+func isCachedList(list ctrl.ObjectList) bool {
+	switch list.(type) {
+	case *unleashv1.UnleashList, *corev1.SecretList, *fqdnV1alpha3.FQDNNetworkPolicyList, *corev1.EventList:
+		return true
+	}
+	return false
+}
+
+func (c *cachedClient) Get(ctx context.Context, key ctrl.ObjectKey, obj ctrl.Object, opts ...ctrl.GetOption) error {
+	if isCached(obj) {
+		return c.cache.Get(ctx, key, obj, opts...)
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *cachedClient) List(ctx context.Context, list ctrl.ObjectList, opts ...ctrl.ListOption) error {
+	if isCachedList(list) {
+		return c.cache.List(ctx, list, opts...)
+	}
+	return c.Client.List(ctx, list, opts...)
+}
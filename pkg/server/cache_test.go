@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	client_go_scheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCachedClient(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	assert.NoError(t, fqdnV1alpha3.AddToScheme(scheme))
+	assert.NoError(t, unleashv1.AddToScheme(scheme))
+	assert.NoError(t, client_go_scheme.AddToScheme(scheme))
+
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "unleash"}
+	}
+
+	// The cache only knows about the cached objects, the API server about
+	// all of them, so that the source of each read can be told apart.
+	cache := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&unleashv1.Unleash{ObjectMeta: meta("cached")},
+		&corev1.Secret{ObjectMeta: meta("cached")},
+		&fqdnV1alpha3.FQDNNetworkPolicy{ObjectMeta: meta("cached")},
+		&corev1.Event{ObjectMeta: meta("cached")},
+	).Build()
+	api := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&unleashv1.Unleash{ObjectMeta: meta("api")},
+		&corev1.Pod{ObjectMeta: meta("api")},
+		&corev1.Event{ObjectMeta: meta("api")},
+	).Build()
+
+	client := newCachedClient(api, cache)
+	key := ctrl.ObjectKey{Namespace: "unleash", Name: "cached"}
+
+	assert.NoError(t, client.Get(ctx, key, &unleashv1.Unleash{}))
+	assert.NoError(t, client.Get(ctx, key, &corev1.Secret{}))
+	assert.NoError(t, client.Get(ctx, key, &fqdnV1alpha3.FQDNNetworkPolicy{}))
+	assert.NoError(t, client.Get(ctx, key, &corev1.Event{}))
+	assert.NoError(t, client.Get(ctx, ctrl.ObjectKey{Namespace: "unleash", Name: "api"}, &corev1.Pod{}))
+
+	unleashes := &unleashv1.UnleashList{}
+	assert.NoError(t, client.List(ctx, unleashes, ctrl.InNamespace("unleash")))
+	assert.Len(t, unleashes.Items, 1)
+	assert.Equal(t, "cached", unleashes.Items[0].Name)
+
+	events := &corev1.EventList{}
+	assert.NoError(t, client.List(ctx, events, ctrl.InNamespace("unleash")))
+	assert.Len(t, events.Items, 1)
+	assert.Equal(t, "cached", events.Items[0].Name)
+
+	pods := &corev1.PodList{}
+	assert.NoError(t, client.List(ctx, pods, ctrl.InNamespace("unleash")))
+	assert.Len(t, pods.Items, 1)
+
+	// Writes go to the API server
+	assert.NoError(t, client.Create(ctx, &unleashv1.Unleash{ObjectMeta: meta("new")}))
+	assert.NoError(t, api.Get(ctx, ctrl.ObjectKey{Namespace: "unleash", Name: "new"}, &unleashv1.Unleash{}))
+	assert.Error(t, cache.Get(ctx, ctrl.ObjectKey{Namespace: "unleash", Name: "new"}, &unleashv1.Unleash{}))
+}
@@ -2,27 +2,56 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
 	"github.com/gin-gonic/gin"
 	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
 	"github.com/nais/bifrost/pkg/handler"
+	"github.com/nais/bifrost/pkg/iap"
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/nais/bifrost/pkg/metrics"
+	"github.com/nais/bifrost/pkg/registry"
 	"github.com/nais/bifrost/pkg/server/utils"
+	"github.com/nais/bifrost/pkg/teams"
+	"github.com/nais/bifrost/pkg/tracing"
 	"github.com/nais/bifrost/pkg/unleash"
 	unleashv1 "github.com/nais/unleasherator/api/v1"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"google.golang.org/api/option"
 	admin "google.golang.org/api/sqladmin/v1beta4"
+	htransport "google.golang.org/api/transport/http"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	client_go_scheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// initGoogleClients creates the Cloud SQL Admin clients. Requests are traced
+// by a transport of our own, so spans are named after the service.
 func initGoogleClients(ctx context.Context) (*admin.InstancesService, *admin.DatabasesService, *admin.UsersService, error) {
-	googleClient, err := admin.NewService(ctx)
+	transport, err := htransport.NewTransport(ctx, tracing.Transport("sqladmin", nil),
+		option.WithScopes(admin.CloudPlatformScope),
+		option.WithTelemetryDisabled(),
+	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	googleClient, err := admin.NewService(ctx, option.WithHTTPClient(&http.Client{Transport: transport}))
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -30,8 +59,7 @@ func initGoogleClients(ctx context.Context) (*admin.InstancesService, *admin.Dat
 	return googleClient.Instances, googleClient.Databases, googleClient.Users, nil
 }
 
-func initKubernetesClient() (ctrl.Client, error) {
-	var kubeClient ctrl.Client
+func initKubernetesScheme() (*runtime.Scheme, error) {
 	scheme := runtime.NewScheme()
 	if err := fqdnV1alpha3.AddToScheme(scheme); err != nil {
 		return nil, fmt.Errorf("failed to add fqdnV1alpha3 to scheme: %w", err)
@@ -42,49 +70,184 @@ func initKubernetesClient() (ctrl.Client, error) {
 	if err := client_go_scheme.AddToScheme(scheme); err != nil {
 		return nil, fmt.Errorf("failed to add client_go_scheme to scheme: %w", err)
 	}
-	opts := ctrl.Options{
-		Scheme: scheme,
-	}
+	return scheme, nil
+}
+
+func initKubernetesConfig() (*rest.Config, error) {
 	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
 		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
 		}
+		return config, nil
+	}
 
-		kubeClient, err = ctrl.New(config, opts)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
-		}
-	} else {
-		config, err := rest.InClusterConfig()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
-		}
-		kubeClient, err = ctrl.New(config, opts)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
-		}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
+	}
+	return config, nil
+}
+
+func initKubernetesClient() (ctrl.Client, error) {
+	config, err := initKubernetesConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, err := initKubernetesScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	kubeClient, err := ctrl.New(config, ctrl.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
 	return kubeClient, nil
 }
 
-func initLogger() *logrus.Logger {
-	logger := logrus.New()
-	logger.SetLevel(logrus.DebugLevel)
-	logger.SetFormatter(&logrus.JSONFormatter{
-		TimestampFormat: "2006-01-02 15:04:05",
+// initCachedKubernetesClient creates a client that reads Unleash, Secret,
+// FQDNNetworkPolicy and Event objects in namespace from an informer cache. The
+// cache must be started before the client is used.
+func initCachedKubernetesClient(ctx context.Context, namespace string) (*cachedClient, cache.Cache, error) {
+	config, err := initKubernetesConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scheme, err := initKubernetesScheme()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byObject := map[ctrl.Object]cache.ByObject{}
+	for _, obj := range cachedObjects {
+		byObject[obj] = cache.ByObject{}
+	}
+
+	informers, err := cache.New(config, cache.Options{
+		Scheme:            scheme,
+		DefaultNamespaces: map[string]cache.Config{namespace: {}},
+		ByObject:          byObject,
 	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubernetes cache: %w", err)
+	}
 
-	return logger
+	// Register the informers up front so that WaitForCacheSync covers them
+	for _, obj := range cachedObjects {
+		if _, err := informers.GetInformer(ctx, obj); err != nil {
+			return nil, nil, fmt.Errorf("failed to create informer for %T: %w", obj, err)
+		}
+	}
+
+	kubeClient, err := ctrl.New(config, ctrl.Options{Scheme: scheme})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return newCachedClient(kubeClient, informers), informers, nil
 }
 
-func setupRouter(config *config.Config, logger *logrus.Logger, unleashService unleash.IUnleashService) *gin.Engine {
-	router := gin.Default()
-	gin.DefaultWriter = logger.Writer()
+// initLogStreamer creates a LogStreamer for reading pod logs, which the
+// controller-runtime client does not support.
+func initLogStreamer() (unleash.LogStreamer, error) {
+	config, err := initKubernetesConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	return unleash.NewLogStreamer(clientset.CoreV1()), nil
+}
+
+// newRegistryClient creates the client for the custom image registry, shared
+// by the version provider and the image resolver so they use one cache.
+func newRegistryClient(c *config.Config) *registry.Client {
+	registryUrl, _ := unleash.CustomImageRegistry()
+	return registry.NewClient(registryUrl, c.Unleash.ImageRegistryCacheTTL, tracing.HTTPClient("registry"))
+}
+
+// newVersionProvider returns the source of Unleash versions selected by
+// BIFROST_UNLEASH_VERSION_SOURCE.
+func newVersionProvider(c *config.Config, githubProvider *github.Client, registryClient *registry.Client) (github.VersionProvider, error) {
+	_, repository := unleash.CustomImageRegistry()
+	registryProvider := registry.NewVersionProvider(registryClient, repository)
+
+	switch c.Unleash.VersionSource {
+	case config.VersionSourceGitHub, "":
+		return githubProvider, nil
+	case config.VersionSourceRegistry:
+		return registryProvider, nil
+	case config.VersionSourceIntersect:
+		return github.IntersectVersionProviders(githubProvider, registryProvider), nil
+	default:
+		return nil, fmt.Errorf("invalid Unleash version source %q, must be %s, %s or %s", c.Unleash.VersionSource, config.VersionSourceGitHub, config.VersionSourceRegistry, config.VersionSourceIntersect)
+	}
+}
 
-	h := handler.NewHandler(config, logger, unleashService)
+// newGitHubClient creates the GitHub client and the version provider built on
+// it, shared by the handler and the auto-upgrader so they use one cache.
+func newGitHubClient(config *config.Config, registryClient *registry.Client) (*github.Client, github.VersionProvider, error) {
+	githubClient := github.NewClient(config.GitHub.ApiURL, config.GitHub.Token, config.GitHub.CacheTTL, tracing.HTTPClient("github"))
+	versionProvider, err := newVersionProvider(config, githubClient, registryClient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return githubClient, versionProvider, nil
+}
+
+// newHandler creates the handler with the Teams client from config. With
+// authorization enabled at least one admin team is required, as no one could
+// manage instances without a team otherwise.
+func newHandler(config *config.Config, logger *logrus.Logger, unleashService unleash.IUnleashService, githubClient *github.Client, versionProvider github.VersionProvider, instanceInformer cache.Informer) (*handler.Handler, error) {
+	teamsClient := teams.NewCachedClient(teams.NewClient(config.Teams.TeamsApiURL, config.Teams.TeamsApiToken, tracing.HTTPClient("teams")), config.Teams.CacheTTL)
+
+	var authorizer *teams.Authorizer
+	if config.Teams.AuthorizationEnabled {
+		if len(config.Teams.AdminTeams) == 0 {
+			return nil, errors.New("BIFROST_TEAMS_ADMIN_TEAMS must list at least one team when authorization is enabled")
+		}
+		authorizer = teams.NewAuthorizer(teamsClient, config.Teams.AdminTeams)
+	}
+
+	return handler.NewHandler(config, logger, unleashService, versionProvider, githubClient, teamsClient, authorizer, instanceInformer), nil
+}
+
+// setupRouter creates the router. ready reports whether the server can serve
+// requests, a nil ready is always ready.
+func setupRouter(config *config.Config, logger *logrus.Logger, unleashService unleash.IUnleashService, ready func() bool) (*gin.Engine, error) {
+	githubClient, versionProvider, err := newGitHubClient(config, newRegistryClient(config))
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := newHandler(config, logger, unleashService, githubClient, versionProvider, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRouter(config, logger, h, ready), nil
+}
 
+// newRouter creates the router for h. ready reports whether the server can
+// serve requests, a nil ready is always ready.
+func newRouter(config *config.Config, logger *logrus.Logger, h *handler.Handler, ready func() bool) *gin.Engine {
+	router := gin.New()
+	router.Use(otelgin.Middleware(config.Tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !logging.IsQuietPath(r.URL.Path)
+	})))
+	router.Use(logging.RequestID(logger))
+	router.Use(logging.Middleware(logger))
+	router.Use(logging.Recovery(logger))
+	router.Use(metrics.Middleware())
 	router.Use(h.ErrorHandler)
 	router.Static("/assets", "./assets")
 
@@ -94,46 +257,246 @@ func setupRouter(config *config.Config, logger *logrus.Logger, unleashService un
 	})
 
 	router.GET("/healthz", h.HealthHandler)
+	router.GET("/readyz", h.ReadinessHandler(ready))
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
 
-	unleash := router.Group("/unleash")
+	authenticated := []gin.HandlerFunc{}
+	if config.Google.IAPAuthEnabled {
+		keys := iap.NewJWKKeySource(config.Google.IAPPublicKeysURL, nil)
+		authenticated = append(authenticated, iap.Middleware(iap.NewValidator(config.GoogleIAPAudience(), keys), logger))
+	}
+
+	unleash := router.Group("/unleash", authenticated...)
 	{
 		unleash.GET("/", h.UnleashIndex)
+		unleash.GET("/stream", h.UnleashStatusStream)
 		unleash.GET("/new", h.UnleashNew)
 		unleash.POST("/new", h.UnleashInstancePost)
+		unleash.GET("/upgrade", h.UnleashUpgradeAdminMiddleware, h.UnleashUpgrade)
+		unleash.POST("/upgrade", h.UnleashUpgradeAdminMiddleware, h.UnleashUpgradePost)
 
 		unleashInstance := unleash.Group("/:id")
 		unleashInstance.Use(h.UnleashInstanceMiddleware)
 		{
 			unleashInstance.GET("/", h.UnleashInstanceShow)
+			unleashInstance.GET("/stream", h.UnleashInstanceStatusStream)
+			unleashInstance.GET("/drift", h.UnleashInstanceDrift)
+			unleashInstance.GET("/events", h.UnleashInstanceEvents)
+			unleashInstance.GET("/logs", h.UnleashInstanceLogs)
+			unleashInstance.GET("/logs/stream", h.UnleashInstanceLogsStream)
+			unleashInstance.GET("/logs/download", h.UnleashInstanceLogsDownload)
+			unleashInstance.GET("/changes", h.UnleashInstanceChanges)
 			unleashInstance.GET("/edit", h.UnleashInstanceEdit)
 			unleashInstance.POST("/edit", h.UnleashInstancePost)
 			unleashInstance.GET("/delete", h.UnleashInstanceDelete)
 			unleashInstance.POST("/delete", h.UnleashInstanceDeletePost)
+			unleashInstance.POST("/repair", h.UnleashInstanceRepairPost)
 		}
 	}
 
+	api := router.Group("/api/v1", authenticated...)
+	{
+		apiUnleash := api.Group("/unleash")
+		{
+			apiUnleash.GET("", h.UnleashApiList)
+			apiUnleash.POST("", h.UnleashApiCreate)
+
+			apiUnleashInstance := apiUnleash.Group("/:name")
+			apiUnleashInstance.Use(h.UnleashApiInstanceMiddleware)
+			{
+				apiUnleashInstance.GET("", h.UnleashApiGet)
+				apiUnleashInstance.PUT("", h.UnleashApiUpdate)
+				apiUnleashInstance.DELETE("", h.UnleashApiDelete)
+				apiUnleashInstance.GET("/events", h.UnleashApiEvents)
+			}
+		}
+
+		apiUpgrades := api.Group("/upgrades")
+		apiUpgrades.Use(h.UpgradeApiAdminMiddleware)
+		{
+			apiUpgrades.POST("", h.UpgradeApiCreate)
+			apiUpgrades.GET("/current", h.UpgradeApiCurrent)
+		}
+
+		api.GET("/teams", h.TeamsApiSearch)
+		api.GET("/namespaces", h.NamespacesApiSearch)
+	}
+
 	return router
 }
 
+// InitUnleashService creates an UnleashService backed by the Kubernetes and
+// Cloud SQL Admin APIs.
+func InitUnleashService(ctx context.Context, config *config.Config, logger *logrus.Logger) (*unleash.UnleashService, error) {
+	kubeClient, err := initKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return newUnleashService(ctx, config, logger, kubeClient, nil, newRegistryClient(config), nil)
+}
+
+// newUnleashService creates the UnleashService. apiClient reads from the API
+// server when kubeClient reads from a cache, and is nil otherwise.
+func newUnleashService(ctx context.Context, config *config.Config, logger *logrus.Logger, kubeClient ctrl.Client, apiClient ctrl.Client, registryClient *registry.Client, logStreamer unleash.LogStreamer) (*unleash.UnleashService, error) {
+	_, sqlDatabasesClient, sqlUsersClient, err := initGoogleClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, repository := unleash.CustomImageRegistry()
+	imageResolver := registry.NewImageResolver(registryClient, repository)
+
+	var apiReader ctrl.Reader
+	if apiClient != nil {
+		apiReader = tracing.WrapClient(apiClient)
+	}
+
+	return unleash.NewUnleashService(sqlDatabasesClient, sqlUsersClient, tracing.WrapClient(kubeClient), apiReader, imageResolver, logStreamer, config, logger), nil
+}
+
 func Run(config *config.Config) {
-	logger := initLogger()
+	logger, err := logging.New(config.Log.Level, config.Log.Format)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	ctx := context.Background()
 
-	kubeClient, err := initKubernetesClient()
+	shutdownTracing, err := tracing.Setup(ctx, config.Tracing, config.Meta.Version)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	kubeClient, informers, err := initCachedKubernetesClient(ctx, config.Unleash.InstanceNamespace)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logStreamer, err := initLogStreamer()
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	_, sqlDatabasesClient, sqlUsersClient, err := initGoogleClients(context.Background())
+	registryClient := newRegistryClient(config)
+
+	unleashService, err := newUnleashService(ctx, config, logger, kubeClient, kubeClient.Client, registryClient, logStreamer)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	githubClient, versionProvider, err := newGitHubClient(config, registryClient)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	unleashService := unleash.NewUnleashService(sqlDatabasesClient, sqlUsersClient, kubeClient, config, logger)
+	var autoUpgrader *unleash.AutoUpgrader
+	if config.Unleash.AutoUpgradeInterval > 0 {
+		window, err := unleash.ParseMaintenanceWindow(config.Unleash.AutoUpgradeWindow, config.Unleash.AutoUpgradeTimezone)
+		if err != nil {
+			logger.Fatal(err)
+		}
 
-	router := setupRouter(config, logger, unleashService)
+		autoUpgrader = unleash.NewAutoUpgrader(unleashService, versionProvider, unleashService, window, unleash.UpgradeOptions{
+			ReadyTimeout: config.Unleash.UpgradeReadyTimeout,
+		}, logger)
+	}
 
-	logger.Infof("Listening on %s", config.GetServerAddr())
-	if err := router.Run(config.GetServerAddr()); err != nil {
+	// Background workers are stopped after the server has finished serving
+	// in-flight requests, which read from the informer cache.
+	workers, stopWorkers := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := informers.Start(workers); err != nil {
+			logger.Fatal(err)
+		}
+	}()
+
+	var ready atomic.Bool
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if !informers.WaitForCacheSync(workers) {
+			if workers.Err() == nil {
+				logger.Fatal("Kubernetes cache did not sync")
+			}
+			return
+		}
+		ready.Store(true)
+		logger.Info("Kubernetes cache synced")
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unleash.RunFleetMetrics(workers, unleashService, config.Unleash.FleetMetricsInterval, logger)
+		}()
+
+		if autoUpgrader != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				autoUpgrader.Run(workers, config.Unleash.AutoUpgradeInterval)
+			}()
+		}
+	}()
+
+	instanceInformer, err := informers.GetInformer(ctx, &unleashv1.Unleash{})
+	if err != nil {
 		logger.Fatal(err)
 	}
+
+	h, err := newHandler(config, logger, unleashService, githubClient, versionProvider, instanceInformer)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	srv := newHTTPServer(config, newRouter(config, logger, h, ready.Load))
+
+	go func() {
+		logger.Infof("Listening on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal(err)
+		}
+	}()
+
+	signals, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-signals.Done()
+
+	logger.Info("Shutting down")
+	ready.Store(false)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Duration(config.Server.GracefulTimeout)*time.Second)
+	defer cancel()
+
+	if err := h.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Error stopping fleet upgrade")
+	}
+
+	// Stop accepting requests and wait for in-flight requests, such as
+	// provisioning an instance, to finish
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Error waiting for requests to finish")
+	}
+
+	stopWorkers()
+	wg.Wait()
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Error exporting traces")
+	}
+
+	logger.Info("Shutdown complete")
+}
+
+// newHTTPServer creates a server for handler with the timeouts from config.
+func newHTTPServer(config *config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         config.GetServerAddr(),
+		Handler:      handler,
+		ReadTimeout:  time.Duration(config.Server.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(config.Server.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(config.Server.IdleTimeout) * time.Second,
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,11 +13,19 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
+	"github.com/nais/bifrost/pkg/handler"
+	"github.com/nais/bifrost/pkg/registry"
+	"github.com/nais/bifrost/pkg/tracing"
 	"github.com/nais/bifrost/pkg/unleash"
 	unleashv1 "github.com/nais/unleasherator/api/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -36,7 +45,7 @@ func (s *MockUnleashService) Get(ctx context.Context, name string) (*unleash.Unl
 		}
 	}
 
-	return nil, fmt.Errorf("instance not found")
+	return nil, apierrors.NewNotFound(unleashv1.GroupVersion.WithResource("unleashes").GroupResource(), name)
 }
 
 func (s *MockUnleashService) Create(ctx context.Context, uc *unleash.UnleashConfig) (*unleashv1.Unleash, error) {
@@ -75,6 +84,46 @@ func (s *MockUnleashService) Delete(ctx context.Context, name string) error {
 	return fmt.Errorf("instance not found")
 }
 
+func (s *MockUnleashService) Repair(ctx context.Context, name string) ([]string, error) {
+	for _, instance := range s.Instances {
+		if instance.Name == name {
+			return []string{"fqdn network policy"}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("instance not found")
+}
+
+func (s *MockUnleashService) Events(ctx context.Context, name string) ([]unleash.InstanceEvent, error) {
+	for _, instance := range s.Instances {
+		if instance.Name == name {
+			return []unleash.InstanceEvent{{
+				Type:      "Warning",
+				Reason:    "BackOff",
+				Message:   "Back-off restarting failed container",
+				Object:    "Pod/" + name + "-abc",
+				Count:     3,
+				FirstSeen: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				LastSeen:  time.Date(2024, 1, 2, 3, 14, 5, 0, time.UTC),
+			}}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("instance not found")
+}
+
+func (s *MockUnleashService) Pods(ctx context.Context, name string) ([]unleash.InstancePod, error) {
+	return []unleash.InstancePod{{Name: name + "-abc", Phase: "Running"}}, nil
+}
+
+func (s *MockUnleashService) Logs(ctx context.Context, name string, opts unleash.LogOptions) (io.ReadCloser, error) {
+	if opts.Container != unleash.UnleashContainer && opts.Container != unleash.SQLProxyContainer {
+		return nil, unleash.ErrLogTargetNotFound
+	}
+
+	return io.NopCloser(strings.NewReader(fmt.Sprintf("%s line 1\n%s line 2\n", opts.Container, opts.Container))), nil
+}
+
 func unleashConfigToForm(uc *unleash.UnleashConfig) string {
 	enableFederation := ""
 	if uc.EnableFederation {
@@ -98,23 +147,75 @@ func TestHealthzRoute(t *testing.T) {
 	logger := logrus.New()
 	service := &MockUnleashService{c: config}
 
-	router := setupRouter(config, logger, service)
+	router, err := setupRouter(config, logger, service, nil)
+	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/healthz", nil)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, 200, w.Code)
 	assert.Equal(t, "OK", w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
 }
 
-func TestMetricsRoute(t *testing.T) {
-	t.Skip()
+func TestReadyzRoute(t *testing.T) {
+	config := &config.Config{}
+	logger := logrus.New()
+	service := &MockUnleashService{c: config}
+
+	ready := false
+	router, err := setupRouter(config, logger, service, func() bool { return ready })
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 503, w.Code)
+
+	ready = true
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "OK", w.Body.String())
+}
+
+func TestIAPAuthentication(t *testing.T) {
+	config := &config.Config{
+		Google: config.GoogleConfig{
+			IAPAuthEnabled: true,
+		},
+	}
+	logger := logrus.New()
+	service := &MockUnleashService{c: config}
+
+	router, err := setupRouter(config, logger, service, nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
 
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/unleash", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestMetricsRoute(t *testing.T) {
 	config := &config.Config{}
 	logger := logrus.New()
 	service := &MockUnleashService{c: config}
 
-	router := setupRouter(config, logger, service)
+	router, err := setupRouter(config, logger, service, nil)
+	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/metrics", nil)
 	router.ServeHTTP(w, req)
@@ -123,6 +224,43 @@ func TestMetricsRoute(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "go_gc_duration_seconds")
 }
 
+func TestNewVersionProvider(t *testing.T) {
+	githubClient := github.NewClient("", "", time.Minute, nil)
+	registryClient := registry.NewClient("", time.Minute, nil)
+
+	for _, source := range []string{"", config.VersionSourceGitHub, config.VersionSourceRegistry, config.VersionSourceIntersect} {
+		provider, err := newVersionProvider(&config.Config{Unleash: config.UnleashConfig{VersionSource: source}}, githubClient, registryClient)
+		assert.NoError(t, err)
+		assert.NotNil(t, provider)
+	}
+
+	_, err := newVersionProvider(&config.Config{Unleash: config.UnleashConfig{VersionSource: "gitlab"}}, githubClient, registryClient)
+	assert.EqualError(t, err, `invalid Unleash version source "gitlab", must be github, registry or github-and-registry`)
+}
+
+func TestNewHandlerRequiresAdminTeams(t *testing.T) {
+	c := &config.Config{Teams: config.TeamsConfig{AuthorizationEnabled: true}}
+
+	_, err := newHandler(c, logrus.New(), nil, nil, nil, nil)
+	assert.EqualError(t, err, "BIFROST_TEAMS_ADMIN_TEAMS must list at least one team when authorization is enabled")
+
+	c.Teams.AdminTeams = []string{"nais"}
+	_, err = newHandler(c, logrus.New(), nil, nil, nil, nil)
+	assert.NoError(t, err)
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	c := &config.Config{Server: config.ServerConfig{Host: "127.0.0.1", Port: "8080", ReadTimeout: 5, WriteTimeout: 10, IdleTimeout: 60}}
+	router := gin.New()
+
+	srv := newHTTPServer(c, router)
+	assert.Equal(t, "127.0.0.1:8080", srv.Addr)
+	assert.Equal(t, router, srv.Handler)
+	assert.Equal(t, 5*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 10*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 60*time.Second, srv.IdleTimeout)
+}
+
 func newUnleashRoute() (c *config.Config, service *MockUnleashService, router *gin.Engine) {
 	c = &config.Config{
 		Server: config.ServerConfig{
@@ -178,7 +316,10 @@ func newUnleashRoute() (c *config.Config, service *MockUnleashService, router *g
 		},
 	}
 
-	router = setupRouter(c, logger, service)
+	router, err := setupRouter(c, logger, service, nil)
+	if err != nil {
+		panic(err)
+	}
 
 	return
 }
@@ -362,6 +503,30 @@ func TestUnleashGet(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "<span class=\"ui label\">debug</span>")
 }
 
+func TestUnleashTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+
+	_, _, router := newUnleashRoute()
+
+	for _, path := range []string{"/healthz", "/unleash/team-a/"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+	}
+
+	// Probes are not traced
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+	assert.Equal(t, "/unleash/:id/", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, tracing.Instance("team-a"))
+}
+
 func TestUnleashDelete(t *testing.T) {
 	_, service, router := newUnleashRoute()
 
@@ -386,3 +551,229 @@ func TestUnleashDelete(t *testing.T) {
 	assert.Equal(t, "/unleash", w.Header().Get("Location"))
 	assert.Equal(t, 1, len(service.Instances))
 }
+
+func TestUnleashRepair(t *testing.T) {
+	_, _, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<form class=\"ui form\" method=\"POST\" action=\"./repair\" style=\"display: inline;\">")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-a/repair", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 302, w.Code)
+	assert.Equal(t, "/unleash/team-a/?repaired=fqdn+network+policy&status=repaired", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/?repaired=fqdn+network+policy&status=repaired", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "Recreated missing resources: fqdn network policy")
+}
+
+func TestUnleashDrift(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/drift", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"name":"team-a","drifted":false,"fields":[]}`, w.Body.String())
+
+	service.Instances[0].ServerInstance.Spec.Size = 2
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/drift", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"name":"team-a","drifted":true,"fields":[{"path":"spec.size","live":"2","desired":"1"}]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 1, strings.Count(w.Body.String(), ">Drifted</div>"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<td><code>spec.size</code></td>")
+}
+
+func TestUnleashEvents(t *testing.T) {
+	_, _, router := newUnleashRoute()
+
+	expected := `{"name":"team-a","events":[{"type":"Warning","reason":"BackOff","message":"Back-off restarting failed container","object":"Pod/team-a-abc","source":"","count":3,"first-seen":"2024-01-02T03:04:05Z","last-seen":"2024-01-02T03:14:05Z"}]}`
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/events", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, expected, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/unleash/team-a/events", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, expected, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<tr class=\"warning\">")
+	assert.Contains(t, w.Body.String(), "<td title=\"First seen 2024-01-02 03:04:05\">2024-01-02 03:14:05</td>")
+	assert.Contains(t, w.Body.String(), "<td>Back-off restarting failed container</td>")
+}
+
+func TestUnleashLogs(t *testing.T) {
+	_, _, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/logs", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<option value=\"team-a-abc\">team-a-abc (Running)</option>")
+	assert.Contains(t, w.Body.String(), "<option value=\"sql-proxy\">sql-proxy</option>")
+	assert.Contains(t, w.Body.String(), "<option value=\"500\" selected>500</option>")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/logs/stream?container=sql-proxy&follow=false", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "event:log\ndata:sql-proxy line 1\n\nevent:log\ndata:sql-proxy line 2\n\nevent:end\ndata:\n\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/logs/download?container=unleash", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `attachment; filename="team-a-unleash.log"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "unleash line 1\nunleash line 2\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/logs/download?container=other", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/logs/stream?tail=all", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestUnleashUpgrade(t *testing.T) {
+	_, _, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/upgrade", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "<h3 class=\"ui header\">Plan</h3>")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/upgrade?version=v5.10.2-20240329-070801-0180a96&older-than=2.0.0", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<td><a href=\"/unleash/team-a/\">team-a</a></td>")
+	assert.NotContains(t, w.Body.String(), "<td><a href=\"/unleash/team-b/\">team-b</a></td>")
+	assert.Contains(t, w.Body.String(), "Upgrade 1 instances")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/upgrade?version=v5.10.2-20240329-070801-0180a96&older-than=latest", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid semantic version: latest")
+}
+
+func TestUnleashApi(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/unleash", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var list handler.UnleashInstanceListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, 2, len(list.Instances))
+	assert.Equal(t, "team-a", list.Instances[0].Name)
+	assert.Equal(t, "1.2.3", list.Instances[0].Version)
+	assert.Equal(t, "v1.2.3-00000000-000000-abcd1234", list.Instances[0].CustomVersion)
+	assert.Equal(t, "team-a,team-b", list.Instances[0].AllowedTeams)
+	assert.Equal(t, "team-b", list.Instances[1].Name)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/unleash/team-a", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"team-a"`)
+	assert.Contains(t, w.Body.String(), `"log-level":"debug"`)
+	assert.Contains(t, w.Body.String(), `"enable-federation":true`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/unleash/does-not-exist", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+	assert.JSONEq(t, `{"error":"Unleash instance does-not-exist not found"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/unleash", strings.NewReader(`{"name": "my_invalid_name!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), `"validationError"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/unleash", strings.NewReader(`{"name": "team-a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 409, w.Code)
+	assert.JSONEq(t, `{"error":"Unleash instance team-a already exists"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/unleash", strings.NewReader(`{"name": "my-name", "allowed-teams": "team-c", "log-level": "info"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+
+	var created handler.UnleashInstanceResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "my-name", created.Name)
+	assert.Equal(t, "team-c", created.AllowedTeams)
+	assert.Equal(t, "info", created.LogLevel)
+	assert.Equal(t, 3, created.DatabasePoolMax)
+	assert.Equal(t, 3, len(service.Instances))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/unleash/my-name", strings.NewReader(`{"log-level": "error"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var updated handler.UnleashInstanceResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "error", updated.LogLevel)
+	assert.Equal(t, "team-c", updated.AllowedTeams)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/unleash/my-name", strings.NewReader(`{"database-pool-max": 100}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/v1/unleash/my-name", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 204, w.Code)
+	assert.Equal(t, 2, len(service.Instances))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/v1/unleash/my-name", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
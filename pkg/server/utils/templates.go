@@ -6,6 +6,8 @@ import (
 
 	"github.com/gin-contrib/multitemplate"
 	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
+	"github.com/nais/bifrost/pkg/utils"
 )
 
 func LoadFuncMap(c *config.Config) template.FuncMap {
@@ -31,6 +33,10 @@ func LoadFuncMap(c *config.Config) template.FuncMap {
 		"repoUrl": func() string {
 			return c.Meta.RepoUrl()
 		},
+		"split": func(s, sep string) []string {
+			return utils.SplitNoEmpty(s, sep)
+		},
+		"groupVersions": github.GroupUnleashVersions,
 	}
 }
 
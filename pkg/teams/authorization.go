@@ -0,0 +1,70 @@
+package teams
+
+import (
+	"context"
+	"slices"
+)
+
+// Access describes what a user is allowed to manage.
+type Access struct {
+	User  string
+	Teams []string
+	Admin bool
+}
+
+// CanAccess reports whether the user is a platform admin or a member of one of
+// the allowed teams.
+func (a *Access) CanAccess(allowedTeams []string) bool {
+	if a.Admin {
+		return true
+	}
+
+	for _, team := range allowedTeams {
+		if slices.Contains(a.Teams, team) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanAssign reports whether the user may give the team access to an instance
+// or take it away. Platform admins may assign any team, other users only the
+// teams they are a member of.
+func (a *Access) CanAssign(team string) bool {
+	return a.Admin || slices.Contains(a.Teams, team)
+}
+
+// Authorizer resolves a user's access from their team memberships.
+type Authorizer struct {
+	client     Client
+	adminTeams []string
+}
+
+func NewAuthorizer(client Client, adminTeams []string) *Authorizer {
+	return &Authorizer{
+		client:     client,
+		adminTeams: adminTeams,
+	}
+}
+
+func (a *Authorizer) Access(ctx context.Context, email string) (*Access, error) {
+	teams, err := a.client.UserTeams(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	access := &Access{
+		User:  email,
+		Teams: teams,
+	}
+
+	for _, team := range a.adminTeams {
+		if slices.Contains(teams, team) {
+			access.Admin = true
+			break
+		}
+	}
+
+	return access, nil
+}
@@ -0,0 +1,61 @@
+package teams
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	teams    map[string][]string
+	allTeams []string
+	err      error
+	calls    int
+}
+
+func (f *fakeClient) UserTeams(ctx context.Context, email string) ([]string, error) {
+	f.calls++
+	teams, ok := f.teams[email]
+	if !ok {
+		return nil, fmt.Errorf("unknown user %s", email)
+	}
+	return teams, nil
+}
+
+func (f *fakeClient) Teams(ctx context.Context) ([]string, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.allTeams, nil
+}
+
+func TestAuthorizer(t *testing.T) {
+	client := &fakeClient{teams: map[string][]string{
+		"member@example.com": {"team-a", "team-b"},
+		"admin@example.com":  {"team-c", "platform"},
+	}}
+	authorizer := NewAuthorizer(client, []string{"platform"})
+	ctx := context.Background()
+
+	access, err := authorizer.Access(ctx, "member@example.com")
+	assert.NoError(t, err)
+	assert.False(t, access.Admin)
+	assert.True(t, access.CanAccess([]string{"team-b", "team-x"}))
+	assert.False(t, access.CanAccess([]string{"team-c"}))
+	assert.False(t, access.CanAccess([]string{}))
+	assert.True(t, access.CanAssign("team-a"))
+	assert.False(t, access.CanAssign("team-c"))
+
+	access, err = authorizer.Access(ctx, "admin@example.com")
+	assert.NoError(t, err)
+	assert.True(t, access.Admin)
+	assert.True(t, access.CanAccess([]string{"team-a"}))
+	assert.True(t, access.CanAccess([]string{}))
+	assert.True(t, access.CanAssign("team-a"))
+
+	_, err = authorizer.Access(ctx, "unknown@example.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package teams
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const allTeamsCacheKey = "teams"
+
+type cacheEntry struct {
+	value     []string
+	expiresAt time.Time
+}
+
+// CachedClient keeps the responses of another Client in memory for the given
+// TTL, so that autocompletion and validation do not hit the Teams API on every
+// request. Concurrent requests for the same response share a single call, and
+// expired responses are swept once per TTL.
+type CachedClient struct {
+	client  Client
+	ttl     time.Duration
+	now     func() time.Time
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	nextSweep time.Time
+}
+
+func NewCachedClient(client Client, ttl time.Duration) *CachedClient {
+	return &CachedClient{
+		client:  client,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+func (c *CachedClient) UserTeams(ctx context.Context, email string) ([]string, error) {
+	return c.get(ctx, "user:"+email, func(ctx context.Context) ([]string, error) {
+		return c.client.UserTeams(ctx, email)
+	})
+}
+
+func (c *CachedClient) Teams(ctx context.Context) ([]string, error) {
+	return c.get(ctx, allTeamsCacheKey, func(ctx context.Context) ([]string, error) {
+		return c.client.Teams(ctx)
+	})
+}
+
+func (c *CachedClient) get(ctx context.Context, key string, fetch func(ctx context.Context) ([]string, error)) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok && c.now().Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	value, err, _ := c.fetches.Do(key, func() (interface{}, error) {
+		// The call is shared, so it must not be cancelled with the request
+		// that started it
+		value, err := fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		c.set(key, value)
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]string), nil
+}
+
+func (c *CachedClient) set(key string, value []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.After(c.nextSweep) {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+
+	c.entries[key] = cacheEntry{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// Search returns the team slugs containing query, ignoring case. Slugs
+// starting with the query are listed first. A limit of zero returns all
+// matches.
+func Search(ctx context.Context, client Client, query string, limit int) ([]string, error) {
+	teams, err := client.Teams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	matches := []string{}
+	for _, team := range teams {
+		if strings.Contains(strings.ToLower(team), query) {
+			matches = append(matches, team)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		iPrefix := strings.HasPrefix(strings.ToLower(matches[i]), query)
+		jPrefix := strings.HasPrefix(strings.ToLower(matches[j]), query)
+		if iPrefix != jPrefix {
+			return iPrefix
+		}
+		return matches[i] < matches[j]
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,139 @@
+package teams
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedClient(t *testing.T) {
+	client := &fakeClient{
+		teams:    map[string][]string{"member@example.com": {"team-a"}},
+		allTeams: []string{"team-a", "team-b"},
+	}
+	cached := NewCachedClient(client, time.Minute)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cached.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		teams, err := cached.Teams(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"team-a", "team-b"}, teams)
+
+		userTeams, err := cached.UserTeams(ctx, "member@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"team-a"}, userTeams)
+	}
+	assert.Equal(t, 2, client.calls)
+
+	now = now.Add(2 * time.Minute)
+	client.allTeams = []string{"team-a", "team-b", "team-c"}
+
+	teams, err := cached.Teams(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "team-b", "team-c"}, teams)
+	assert.Equal(t, 3, client.calls)
+}
+
+func TestCachedClientDoesNotCacheErrors(t *testing.T) {
+	client := &fakeClient{err: errors.New("teams api down")}
+	cached := NewCachedClient(client, time.Minute)
+	ctx := context.Background()
+
+	_, err := cached.Teams(ctx)
+	assert.EqualError(t, err, "teams api down")
+
+	client.err = nil
+	client.allTeams = []string{"team-a"}
+
+	teams, err := cached.Teams(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a"}, teams)
+}
+
+func TestCachedClientSweepsExpiredEntries(t *testing.T) {
+	client := &fakeClient{teams: map[string][]string{
+		"a@example.com": {"team-a"},
+		"b@example.com": {"team-b"},
+	}}
+	cached := NewCachedClient(client, time.Minute)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cached.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := cached.UserTeams(ctx, "a@example.com")
+	assert.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	_, err = cached.UserTeams(ctx, "b@example.com")
+	assert.NoError(t, err)
+
+	assert.Len(t, cached.entries, 1)
+	assert.Contains(t, cached.entries, "user:b@example.com")
+}
+
+type blockingClient struct {
+	Client
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (b *blockingClient) Teams(ctx context.Context) ([]string, error) {
+	b.calls.Add(1)
+	<-b.release
+	return []string{"team-a"}, nil
+}
+
+func TestCachedClientSharesConcurrentCalls(t *testing.T) {
+	client := &blockingClient{release: make(chan struct{})}
+	cached := NewCachedClient(client, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			teams, err := cached.Teams(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"team-a"}, teams)
+		}()
+	}
+
+	// Give the goroutines time to join the call before it returns
+	time.Sleep(50 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), client.calls.Load())
+}
+
+func TestSearch(t *testing.T) {
+	client := &fakeClient{allTeams: []string{"my-team", "team-b", "Team-A", "other", "teamwork"}}
+
+	testCases := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{name: "empty query", query: "", want: []string{"Team-A", "my-team", "other", "team-b", "teamwork"}},
+		{name: "prefix matches first", query: "team", want: []string{"Team-A", "team-b", "teamwork", "my-team"}},
+		{name: "case insensitive", query: "TEAM-A", want: []string{"Team-A"}},
+		{name: "limit", query: "team", limit: 2, want: []string{"Team-A", "team-b"}},
+		{name: "no matches", query: "nope", want: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Search(context.Background(), client, tc.query, tc.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package teams
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Client talks to the NAIS Teams GraphQL API.
+type Client interface {
+	UserTeams(ctx context.Context, email string) ([]string, error)
+	Teams(ctx context.Context) ([]string, error)
+}
+
+type client struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(url, token string, httpClient *http.Client) Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &client{
+		url:        url,
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (c *client) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from teams api: %d", resp.StatusCode)
+	}
+
+	var res graphQLResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+
+	if len(res.Errors) > 0 {
+		messages := []string{}
+		for _, e := range res.Errors {
+			messages = append(messages, e.Message)
+		}
+		return errors.New("teams api: " + strings.Join(messages, "; "))
+	}
+
+	return json.Unmarshal(res.Data, out)
+}
+
+const userTeamsQuery = `query UserTeams($email: String!, $after: Cursor) {
+  user(email: $email) {
+    teams(first: 100, after: $after) {
+      nodes {
+        team {
+          slug
+        }
+      }
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+    }
+  }
+}`
+
+// UserTeams returns the slugs of the teams the user with the given email is a
+// member of, following pagination until the last page.
+func (c *client) UserTeams(ctx context.Context, email string) ([]string, error) {
+	teams := []string{}
+	variables := map[string]interface{}{"email": email}
+
+	for {
+		var data struct {
+			User *struct {
+				Teams struct {
+					Nodes []struct {
+						Team struct {
+							Slug string `json:"slug"`
+						} `json:"team"`
+					} `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"teams"`
+			} `json:"user"`
+		}
+
+		if err := c.query(ctx, userTeamsQuery, variables, &data); err != nil {
+			return nil, err
+		}
+
+		if data.User == nil {
+			return teams, nil
+		}
+
+		for _, node := range data.User.Teams.Nodes {
+			teams = append(teams, node.Team.Slug)
+		}
+
+		if !data.User.Teams.PageInfo.HasNextPage || data.User.Teams.PageInfo.EndCursor == "" {
+			return teams, nil
+		}
+
+		variables["after"] = data.User.Teams.PageInfo.EndCursor
+	}
+}
+
+const teamsQuery = `query Teams($after: Cursor) {
+  teams(first: 100, after: $after) {
+    nodes {
+      slug
+    }
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+  }
+}`
+
+// Teams returns the slugs of all teams, following pagination until the last
+// page.
+func (c *client) Teams(ctx context.Context) ([]string, error) {
+	teams := []string{}
+	variables := map[string]interface{}{}
+
+	for {
+		var data struct {
+			Teams struct {
+				Nodes []struct {
+					Slug string `json:"slug"`
+				} `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"teams"`
+		}
+
+		if err := c.query(ctx, teamsQuery, variables, &data); err != nil {
+			return nil, err
+		}
+
+		for _, node := range data.Teams.Nodes {
+			teams = append(teams, node.Slug)
+		}
+
+		if !data.Teams.PageInfo.HasNextPage || data.Teams.PageInfo.EndCursor == "" {
+			return teams, nil
+		}
+
+		variables["after"] = data.Teams.PageInfo.EndCursor
+	}
+}
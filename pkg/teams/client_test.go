@@ -0,0 +1,116 @@
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserTeams(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		response string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "member of teams",
+			status:   200,
+			response: `{"data": {"user": {"teams": {"nodes": [{"team": {"slug": "team-a"}}, {"team": {"slug": "team-b"}}]}}}}`,
+			want:     []string{"team-a", "team-b"},
+		},
+		{
+			name:     "unknown user",
+			status:   200,
+			response: `{"data": {"user": null}}`,
+			want:     []string{},
+		},
+		{
+			name:     "graphql error",
+			status:   200,
+			response: `{"data": null, "errors": [{"message": "user not found"}]}`,
+			wantErr:  "teams api: user not found",
+		},
+		{
+			name:    "http error",
+			status:  500,
+			wantErr: "unexpected status code from teams api: 500",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "Bearer my-token", r.Header.Get("Authorization"))
+
+				var req graphQLRequest
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, "user@example.com", req.Variables["email"])
+
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "my-token", nil)
+			got, err := client.UserTeams(context.Background(), "user@example.com")
+
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestUserTeamsPagination(t *testing.T) {
+	pages := map[string]string{
+		"":         `{"data": {"user": {"teams": {"nodes": [{"team": {"slug": "team-a"}}], "pageInfo": {"hasNextPage": true, "endCursor": "cursor-1"}}}}}`,
+		"cursor-1": `{"data": {"user": {"teams": {"nodes": [{"team": {"slug": "team-b"}}], "pageInfo": {"hasNextPage": false, "endCursor": "cursor-2"}}}}}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "user@example.com", req.Variables["email"])
+
+		after, _ := req.Variables["after"].(string)
+		_, _ = w.Write([]byte(pages[after]))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "my-token", nil)
+	got, err := client.UserTeams(context.Background(), "user@example.com")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "team-b"}, got)
+}
+
+func TestTeams(t *testing.T) {
+	pages := map[string]string{
+		"":         `{"data": {"teams": {"nodes": [{"slug": "team-a"}, {"slug": "team-b"}], "pageInfo": {"hasNextPage": true, "endCursor": "cursor-1"}}}}`,
+		"cursor-1": `{"data": {"teams": {"nodes": [{"slug": "team-c"}], "pageInfo": {"hasNextPage": false, "endCursor": "cursor-2"}}}}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		after, _ := req.Variables["after"].(string)
+		_, _ = w.Write([]byte(pages[after]))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "my-token", nil)
+	got, err := client.Teams(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "team-b", "team-c"}, got)
+}
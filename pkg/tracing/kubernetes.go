@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Span attributes of Kubernetes requests.
+const (
+	KindKey      = attribute.Key("k8s.kind")
+	NamespaceKey = attribute.Key("k8s.namespace.name")
+	NameKey      = attribute.Key("k8s.object.name")
+)
+
+type tracedClient struct {
+	client.Client
+}
+
+// WrapClient traces the requests made with c. Reads served from an informer
+// cache are traced as well, so spans show whether a read reached the API.
+func WrapClient(c client.Client) client.Client {
+	return &tracedClient{Client: c}
+}
+
+func (c *tracedClient) start(ctx context.Context, verb string, obj runtime.Object, namespace, name string) (context.Context, trace.Span) {
+	kind := c.kind(obj)
+
+	attrs := []attribute.KeyValue{KindKey.String(kind)}
+	if namespace != "" {
+		attrs = append(attrs, NamespaceKey.String(namespace))
+	}
+	if name != "" {
+		attrs = append(attrs, NameKey.String(name))
+	}
+
+	return Start(ctx, "kubernetes "+verb+" "+kind, attrs...)
+}
+
+// kind returns the kind of obj, or of the items if obj is a list.
+func (c *tracedClient) kind(obj runtime.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return "Unknown"
+	}
+
+	if _, ok := obj.(client.ObjectList); ok {
+		return strings.TrimSuffix(gvk.Kind, "List")
+	}
+	return gvk.Kind
+}
+
+// endRequest ends span. Objects that are not found are expected when checking
+// whether an object exists, and do not fail the span.
+func endRequest(span trace.Span, err error) {
+	if apierrors.IsNotFound(err) {
+		span.SetAttributes(attribute.Bool("k8s.not_found", true))
+		err = nil
+	}
+	End(span, err)
+}
+
+func (c *tracedClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) (err error) {
+	ctx, span := c.start(ctx, "Get", obj, key.Namespace, key.Name)
+	defer func() { endRequest(span, err) }()
+
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *tracedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (err error) {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	ctx, span := c.start(ctx, "List", list, listOpts.Namespace, "")
+	defer func() { endRequest(span, err) }()
+
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *tracedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) (err error) {
+	ctx, span := c.start(ctx, "Create", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endRequest(span, err) }()
+
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *tracedClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) (err error) {
+	ctx, span := c.start(ctx, "Update", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endRequest(span, err) }()
+
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *tracedClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) (err error) {
+	ctx, span := c.start(ctx, "Patch", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endRequest(span, err) }()
+
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *tracedClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) (err error) {
+	ctx, span := c.start(ctx, "Delete", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endRequest(span, err) }()
+
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *tracedClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) (err error) {
+	ctx, span := c.start(ctx, "DeleteAllOf", obj, obj.GetNamespace(), "")
+	defer func() { endRequest(span, err) }()
+
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nais/bifrost/pkg/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/nais/bifrost"
+
+// HTTPClientTimeout bounds requests made with HTTPClient, including reading
+// the response body.
+const HTTPClientTimeout = 30 * time.Second
+
+// InstanceKey is the span attribute holding the name of an Unleash instance.
+const InstanceKey = attribute.Key("unleash.instance")
+
+// Instance returns the span attribute for the named Unleash instance.
+func Instance(name string) attribute.KeyValue {
+	return InstanceKey.String(name)
+}
+
+// Setup exports spans over OTLP/HTTP if an endpoint is configured, using the
+// standard OTEL_EXPORTER_OTLP_* variables. Without an endpoint spans are not
+// recorded. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, c config.TracingConfig, version string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if c.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(c.ServiceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks span as failed if err is not nil, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SetInstance adds the instance name to the span in ctx.
+func SetInstance(ctx context.Context, name string) {
+	trace.SpanFromContext(ctx).SetAttributes(Instance(name))
+}
+
+// Transport traces the requests sent through base, or the default transport
+// if base is nil. Spans are named after service and the request method.
+func Transport(service string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return service + " " + r.Method
+	}))
+}
+
+// HTTPClient returns a client whose requests are traced and time out after
+// HTTPClientTimeout.
+func HTTPClient(service string) *http.Client {
+	return &http.Client{Transport: Transport(service, nil), Timeout: HTTPClientTimeout}
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestExporter records the spans of the test in memory.
+func newTestExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return exporter
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value.Emit()
+	}
+	return attrs
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.TracingConfig{ServiceName: "bifrost"}, "test")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestStartEnd(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	ctx, parent := Start(context.Background(), "parent", Instance("team-a"))
+	_, child := Start(ctx, "child")
+	End(child, errors.New("failed"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, "parent", spans[1].Name)
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+	assert.Equal(t, "team-a", attributes(spans[1])[InstanceKey])
+}
+
+func TestWrapClient(t *testing.T) {
+	exporter := newTestExporter(t)
+	ctx := context.Background()
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "unleash"}}
+	c := WrapClient(fake.NewClientBuilder().WithObjects(secret).Build())
+
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{}))
+	assert.Error(t, c.Get(ctx, client.ObjectKey{Namespace: "unleash", Name: "missing"}, &corev1.Secret{}))
+	assert.NoError(t, c.List(ctx, &corev1.SecretList{}, client.InNamespace("unleash")))
+	assert.Error(t, c.Create(ctx, secret.DeepCopy()))
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 4) {
+		return
+	}
+
+	assert.Equal(t, "kubernetes Get Secret", spans[0].Name)
+	assert.Equal(t, map[attribute.Key]string{KindKey: "Secret", NamespaceKey: "unleash", NameKey: "team-a"}, attributes(spans[0]))
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+
+	// Objects that are not found do not fail the span
+	assert.Equal(t, "kubernetes Get Secret", spans[1].Name)
+	assert.Equal(t, "true", attributes(spans[1])["k8s.not_found"])
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+
+	assert.Equal(t, "kubernetes List Secret", spans[2].Name)
+	assert.Equal(t, map[attribute.Key]string{KindKey: "Secret", NamespaceKey: "unleash"}, attributes(spans[2]))
+
+	assert.Equal(t, "kubernetes Create Secret", spans[3].Name)
+	assert.Equal(t, codes.Error, spans[3].Status.Code)
+}
+
+func TestTransport(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The trace is propagated to the server
+		assert.NotEmpty(t, r.Header.Get("traceparent"))
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	shutdown, err := Setup(context.Background(), config.TracingConfig{}, "test")
+	assert.NoError(t, err)
+	defer func() { _ = shutdown(context.Background()) }()
+
+	ctx, span := Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	res, err := HTTPClient("test").Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 204, res.StatusCode)
+	res.Body.Close()
+	span.End()
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	assert.Equal(t, "test GET", spans[0].Name)
+	assert.Equal(t, span.SpanContext().SpanID(), spans[0].Parent.SpanID())
+}
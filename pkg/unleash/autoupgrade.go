@@ -0,0 +1,215 @@
+package unleash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nais/bifrost/pkg/github"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EventRecorder records Kubernetes events on Unleash servers.
+type EventRecorder interface {
+	RecordEvent(ctx context.Context, server *unleashv1.Unleash, eventType, reason, message string) error
+}
+
+// MaintenanceWindow is a daily time range, such as 02:00-05:00, in which
+// automatic upgrades may run. Windows ending before they start span midnight.
+type MaintenanceWindow struct {
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// ParseMaintenanceWindow parses a window such as "02:00-05:00" in the named
+// time zone. An empty window returns nil, which allows upgrades at any time.
+func ParseMaintenanceWindow(window, timezone string) (*MaintenanceWindow, error) {
+	if window == "" {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, ok := strings.Cut(window, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid maintenance window %q, expected HH:MM-HH:MM", window)
+	}
+
+	w := &MaintenanceWindow{Location: location}
+	for _, part := range []struct {
+		value string
+		out   *time.Duration
+	}{{start, &w.Start}, {end, &w.End}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part.value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q, expected HH:MM-HH:MM", window)
+		}
+		*part.out = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+
+	return w, nil
+}
+
+// Contains reports whether t is inside the window. A nil window contains all
+// times.
+func (w *MaintenanceWindow) Contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+
+	t = t.In(w.Location)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	if w.Start <= w.End {
+		return sinceMidnight >= w.Start && sinceMidnight < w.End
+	}
+
+	return sinceMidnight >= w.Start || sinceMidnight < w.End
+}
+
+// AutoUpgradeTarget returns the newest version the channel allows an instance
+// running current to move to, if it is newer than current.
+func AutoUpgradeTarget(channel string, current github.UnleashVersion, versions []github.UnleashVersion) (github.UnleashVersion, bool) {
+	var candidates []github.UnleashVersion
+
+	for _, version := range versions {
+		switch channel {
+		case UpgradeChannelAutoPatch:
+			if version.Semver.Major == current.Semver.Major && version.Semver.Minor == current.Semver.Minor {
+				candidates = append(candidates, version)
+			}
+		case UpgradeChannelAutoMinor:
+			if version.Semver.Major == current.Semver.Major {
+				candidates = append(candidates, version)
+			}
+		}
+	}
+
+	latest, ok := github.LatestUnleashVersion(candidates)
+	if !ok || !latest.IsNewerThan(current) {
+		return github.UnleashVersion{}, false
+	}
+
+	return latest, true
+}
+
+// AutoUpgrader moves instances forward within their upgrade channel.
+type AutoUpgrader struct {
+	service  IUnleashService
+	versions github.VersionProvider
+	recorder EventRecorder
+	window   *MaintenanceWindow
+	opts     UpgradeOptions
+	logger   *logrus.Logger
+	now      func() time.Time
+}
+
+func NewAutoUpgrader(service IUnleashService, versions github.VersionProvider, recorder EventRecorder, window *MaintenanceWindow, opts UpgradeOptions, logger *logrus.Logger) *AutoUpgrader {
+	return &AutoUpgrader{
+		service:  service,
+		versions: versions,
+		recorder: recorder,
+		window:   window,
+		opts:     opts,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Run upgrades instances every interval until ctx is cancelled.
+func (a *AutoUpgrader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.upgrade(ctx); err != nil {
+			a.logger.WithError(err).Error("Error automatically upgrading Unleash instances")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// upgrade runs a single pass over all instances. Instances are upgraded one at
+// a time, and the pass stops when the maintenance window closes. Instances
+// that fail to upgrade do not hold back the rest; their errors are returned
+// together.
+func (a *AutoUpgrader) upgrade(ctx context.Context) error {
+	if !a.window.Contains(a.now()) {
+		return nil
+	}
+
+	versions, err := a.versions.UnleashVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	instances, err := a.service.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, instance := range instances {
+		if !a.window.Contains(a.now()) {
+			a.logger.Info("Maintenance window closed, stopping automatic upgrades of Unleash instances")
+			break
+		}
+
+		if instance.ServerInstance == nil {
+			continue
+		}
+
+		uc := UnleashVariables(instance.ServerInstance, true)
+		if uc.UpgradeChannel == "" || uc.UpgradeChannel == UpgradeChannelPinned {
+			continue
+		}
+
+		current := github.UnleashVersionsFromTags([]string{uc.CustomVersion})
+		if len(current) != 1 {
+			a.logger.Debugf("Not upgrading Unleash instance %s, it does not run a custom version", instance.Name)
+			continue
+		}
+
+		target, ok := AutoUpgradeTarget(uc.UpgradeChannel, current[0], versions)
+		if !ok {
+			continue
+		}
+
+		a.logger.Infof("Upgrading Unleash instance %s from %s to %s (%s)", instance.Name, uc.CustomVersion, target.GitTag, uc.UpgradeChannel)
+
+		if err := upgradeInstance(ctx, a.service, instance.Name, target.GitTag, a.opts); err != nil {
+			a.recordEvent(ctx, instance.ServerInstance, corev1.EventTypeWarning, "AutoUpgradeFailed",
+				fmt.Sprintf("Upgrade from %s to %s (%s) failed: %s", uc.CustomVersion, target.GitTag, uc.UpgradeChannel, err))
+			errs = append(errs, fmt.Errorf("upgrading %s: %w", instance.Name, err))
+			continue
+		}
+
+		a.recordEvent(ctx, instance.ServerInstance, corev1.EventTypeNormal, "AutoUpgraded",
+			fmt.Sprintf("Upgraded from %s to %s (%s)", uc.CustomVersion, target.GitTag, uc.UpgradeChannel))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a *AutoUpgrader) recordEvent(ctx context.Context, server *unleashv1.Unleash, eventType, reason, message string) {
+	if a.recorder == nil {
+		return
+	}
+
+	if err := a.recorder.RecordEvent(ctx, server, eventType, reason, message); err != nil {
+		a.logger.WithError(err).Errorf("Error recording event for Unleash instance %s", server.GetName())
+	}
+}
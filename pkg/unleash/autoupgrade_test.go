@@ -0,0 +1,193 @@
+package unleash
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type fakeVersionProvider []string
+
+func (f fakeVersionProvider) UnleashVersions(ctx context.Context) ([]github.UnleashVersion, error) {
+	return github.UnleashVersionsFromTags(f), nil
+}
+
+type recordedEvent struct {
+	name, eventType, reason, message string
+}
+
+type fakeEventRecorder struct {
+	events []recordedEvent
+}
+
+func (f *fakeEventRecorder) RecordEvent(ctx context.Context, server *unleashv1.Unleash, eventType, reason, message string) error {
+	f.events = append(f.events, recordedEvent{server.GetName(), eventType, reason, message})
+	return nil
+}
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	window, err := ParseMaintenanceWindow("", "UTC")
+	assert.NoError(t, err)
+	assert.Nil(t, window)
+	assert.True(t, window.Contains(time.Now()))
+
+	window, err = ParseMaintenanceWindow("02:00-05:30", "UTC")
+	assert.NoError(t, err)
+	assert.False(t, window.Contains(time.Date(2024, 1, 1, 1, 59, 0, 0, time.UTC)))
+	assert.True(t, window.Contains(time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)))
+	assert.True(t, window.Contains(time.Date(2024, 1, 1, 5, 29, 0, 0, time.UTC)))
+	assert.False(t, window.Contains(time.Date(2024, 1, 1, 5, 30, 0, 0, time.UTC)))
+
+	window, err = ParseMaintenanceWindow("22:00-02:00", "Europe/Oslo")
+	assert.NoError(t, err)
+	assert.True(t, window.Contains(time.Date(2024, 1, 1, 22, 30, 0, 0, time.UTC)))
+	assert.True(t, window.Contains(time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)))
+	assert.False(t, window.Contains(time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC)))
+	assert.False(t, window.Contains(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	_, err = ParseMaintenanceWindow("02:00", "UTC")
+	assert.Error(t, err)
+
+	_, err = ParseMaintenanceWindow("2am-5am", "UTC")
+	assert.Error(t, err)
+
+	_, err = ParseMaintenanceWindow("02:00-05:00", "Nowhere/Special")
+	assert.Error(t, err)
+}
+
+func TestAutoUpgradeTarget(t *testing.T) {
+	versions := github.UnleashVersionsFromTags([]string{
+		"v5.9.0-20240101-090000-aaaaaaa",
+		"v5.9.3-20240201-090000-bbbbbbb",
+		"v5.10.2-20240329-070801-0180a96",
+		"v6.0.0-20240401-090000-ccccccc",
+	})
+	// Sorted newest first
+	current := versions[3]
+
+	target, ok := AutoUpgradeTarget(UpgradeChannelAutoPatch, current, versions)
+	assert.True(t, ok)
+	assert.Equal(t, "v5.9.3-20240201-090000-bbbbbbb", target.GitTag)
+
+	target, ok = AutoUpgradeTarget(UpgradeChannelAutoMinor, current, versions)
+	assert.True(t, ok)
+	assert.Equal(t, "v5.10.2-20240329-070801-0180a96", target.GitTag)
+
+	_, ok = AutoUpgradeTarget(UpgradeChannelPinned, current, versions)
+	assert.False(t, ok)
+
+	_, ok = AutoUpgradeTarget(UpgradeChannelAutoMinor, versions[1], versions)
+	assert.False(t, ok)
+}
+
+func TestAutoUpgrader(t *testing.T) {
+	c := &config.Config{}
+
+	newServer := func(name, channel string) *unleashv1.Unleash {
+		server := newUpgradeTestServer(c, name, name, "v5.9.0-20240101-090000-aaaaaaa", "5.9.0")
+		if channel != "" {
+			server.Annotations = map[string]string{UpgradeChannelAnnotation: channel}
+		}
+		return server
+	}
+
+	versions := fakeVersionProvider{
+		"v5.9.0-20240101-090000-aaaaaaa",
+		"v5.9.3-20240201-090000-bbbbbbb",
+		"v5.10.2-20240329-070801-0180a96",
+	}
+	window, err := ParseMaintenanceWindow("02:00-05:00", "UTC")
+	assert.NoError(t, err)
+
+	t.Run("should upgrade instances within their channel", func(t *testing.T) {
+		service := newUpgradeTestService(c,
+			newServer("pinned", ""),
+			newServer("patch", UpgradeChannelAutoPatch),
+			newServer("minor", UpgradeChannelAutoMinor),
+		)
+		recorder := &fakeEventRecorder{}
+
+		upgrader := NewAutoUpgrader(service, versions, recorder, window, UpgradeOptions{PollInterval: time.Millisecond}, logrus.New())
+		upgrader.now = func() time.Time { return time.Date(2024, 4, 1, 3, 0, 0, 0, time.UTC) }
+
+		assert.NoError(t, upgrader.upgrade(context.Background()))
+
+		assert.Equal(t, customImageForVersion("v5.9.0-20240101-090000-aaaaaaa"), service.instances["pinned"].Spec.CustomImage)
+		assert.Equal(t, customImageForVersion("v5.9.3-20240201-090000-bbbbbbb"), service.instances["patch"].Spec.CustomImage)
+		assert.Equal(t, customImageForVersion("v5.10.2-20240329-070801-0180a96"), service.instances["minor"].Spec.CustomImage)
+		assert.Equal(t, UpgradeChannelAutoPatch, service.instances["patch"].Annotations[UpgradeChannelAnnotation])
+
+		assert.ElementsMatch(t, []recordedEvent{
+			{"patch", corev1.EventTypeNormal, "AutoUpgraded", "Upgraded from v5.9.0-20240101-090000-aaaaaaa to v5.9.3-20240201-090000-bbbbbbb (auto-patch)"},
+			{"minor", corev1.EventTypeNormal, "AutoUpgraded", "Upgraded from v5.9.0-20240101-090000-aaaaaaa to v5.10.2-20240329-070801-0180a96 (auto-minor)"},
+		}, recorder.events)
+	})
+
+	t.Run("should not upgrade outside the maintenance window", func(t *testing.T) {
+		service := newUpgradeTestService(c, newServer("patch", UpgradeChannelAutoPatch))
+
+		upgrader := NewAutoUpgrader(service, versions, nil, window, UpgradeOptions{PollInterval: time.Millisecond}, logrus.New())
+		upgrader.now = func() time.Time { return time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC) }
+
+		assert.NoError(t, upgrader.upgrade(context.Background()))
+		assert.Empty(t, service.updated)
+	})
+
+	t.Run("should record failed upgrades", func(t *testing.T) {
+		service := newUpgradeTestService(c, newServer("patch", UpgradeChannelAutoPatch))
+		service.failing["patch"] = true
+		recorder := &fakeEventRecorder{}
+
+		upgrader := NewAutoUpgrader(service, versions, recorder, nil, UpgradeOptions{PollInterval: time.Millisecond}, logrus.New())
+
+		assert.EqualError(t, upgrader.upgrade(context.Background()), "upgrading patch: update failed")
+		assert.Equal(t, []recordedEvent{
+			{"patch", corev1.EventTypeWarning, "AutoUpgradeFailed", "Upgrade from v5.9.0-20240101-090000-aaaaaaa to v5.9.3-20240201-090000-bbbbbbb (auto-patch) failed: update failed"},
+		}, recorder.events)
+	})
+
+	t.Run("should upgrade the remaining instances after a failure", func(t *testing.T) {
+		service := newUpgradeTestService(c,
+			newServer("failing-a", UpgradeChannelAutoPatch),
+			newServer("patch", UpgradeChannelAutoPatch),
+			newServer("failing-b", UpgradeChannelAutoMinor),
+		)
+		service.failing["failing-a"] = true
+		service.failing["failing-b"] = true
+
+		upgrader := NewAutoUpgrader(service, versions, nil, nil, UpgradeOptions{PollInterval: time.Millisecond}, logrus.New())
+
+		err := upgrader.upgrade(context.Background())
+		assert.ErrorContains(t, err, "upgrading failing-a: update failed")
+		assert.ErrorContains(t, err, "upgrading failing-b: update failed")
+		assert.ElementsMatch(t, []string{"failing-a", "patch", "failing-b"}, service.updated)
+		assert.Equal(t, customImageForVersion("v5.9.3-20240201-090000-bbbbbbb"), service.instances["patch"].Spec.CustomImage)
+	})
+
+	t.Run("should stop when the maintenance window closes", func(t *testing.T) {
+		service := newUpgradeTestService(c,
+			newServer("patch-a", UpgradeChannelAutoPatch),
+			newServer("patch-b", UpgradeChannelAutoPatch),
+		)
+
+		upgrader := NewAutoUpgrader(service, versions, nil, window, UpgradeOptions{PollInterval: time.Millisecond}, logrus.New())
+		calls := 0
+		upgrader.now = func() time.Time {
+			calls++
+			if calls > 2 {
+				return time.Date(2024, 4, 1, 5, 0, 0, 0, time.UTC)
+			}
+			return time.Date(2024, 4, 1, 4, 59, 0, 0, time.UTC)
+		}
+
+		assert.NoError(t, upgrader.upgrade(context.Background()))
+		assert.Len(t, service.updated, 1)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 
+	"github.com/nais/bifrost/pkg/logging"
 	admin "google.golang.org/api/sqladmin/v1beta4"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -20,6 +21,7 @@ func createDatabase(ctx context.Context, client ISQLDatabasesService, projectNam
 	if err != nil {
 		return database, &UnleashError{Err: err, Reason: "failed to create database"}
 	}
+	logging.FromContext(ctx).Infof("Created database %s", databaseName)
 
 	return database, nil
 }
@@ -39,15 +41,40 @@ func createDatabaseUser(ctx context.Context, client ISQLUsersService, projectNam
 		return nil, err
 	}
 
+	return createDatabaseUserWithPassword(ctx, client, projectName, instanceName, databaseName, password)
+}
+
+func createDatabaseUserWithPassword(ctx context.Context, client ISQLUsersService, projectName, instanceName, databaseName, password string) (*admin.User, error) {
 	user := &admin.User{
 		Name:     databaseName,
 		Password: password,
 	}
 
-	_, err = client.Insert(projectName, instanceName, user).Context(ctx).Do()
+	_, err := client.Insert(projectName, instanceName, user).Context(ctx).Do()
 	if err != nil {
 		return user, &UnleashError{Err: err, Reason: "failed to create database user"}
 	}
+	logging.FromContext(ctx).Infof("Created database user %s", databaseName)
+
+	return user, nil
+}
+
+func resetDatabaseUserPassword(ctx context.Context, client ISQLUsersService, projectName, instanceName, databaseName string) (*admin.User, error) {
+	password, err := randomPassword(16)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &admin.User{
+		Name:     databaseName,
+		Password: password,
+	}
+
+	_, err = client.Update(projectName, instanceName, user).Name(databaseName).Context(ctx).Do()
+	if err != nil {
+		return user, &UnleashError{Err: err, Reason: "failed to reset database user password"}
+	}
+	logging.FromContext(ctx).Infof("Reset password of database user %s", databaseName)
 
 	return user, nil
 }
@@ -57,6 +84,7 @@ func deleteDatabaseUser(ctx context.Context, client ISQLUsersService, projectNam
 	if err != nil {
 		return &UnleashError{Err: err, Reason: "failed to delete database user"}
 	}
+	logging.FromContext(ctx).Infof("Deleted database user %s", databaseName)
 
 	return nil
 }
@@ -74,7 +102,7 @@ func randomPassword(length int) (string, error) {
 }
 
 func getDatabase(ctx context.Context, client ISQLDatabasesService, projectName, instanceName, databaseName string) (*admin.Database, error) {
-	database, err := client.Get(projectName, instanceName, databaseName).Do()
+	database, err := client.Get(projectName, instanceName, databaseName).Context(ctx).Do()
 	if err != nil {
 		return database, &UnleashError{Err: err, Reason: "failed to get database"}
 	}
@@ -83,10 +111,11 @@ func getDatabase(ctx context.Context, client ISQLDatabasesService, projectName,
 }
 
 func deleteDatabase(ctx context.Context, client ISQLDatabasesService, projectName, instanceName, databaseName string) error {
-	_, err := client.Delete(projectName, instanceName, databaseName).Do()
+	_, err := client.Delete(projectName, instanceName, databaseName).Context(ctx).Do()
 	if err != nil {
 		return &UnleashError{Err: err, Reason: "failed to delete database"}
 	}
+	logging.FromContext(ctx).Infof("Deleted database %s", databaseName)
 
 	return nil
 }
@@ -112,10 +141,26 @@ func createDatabaseUserSecret(ctx context.Context, client ctrl.Client, namespace
 	if err := client.Create(ctx, secret); err != nil {
 		return &UnleashError{Err: err, Reason: "failed to create database user secret"}
 	}
+	logging.FromContext(ctx).Infof("Created database user secret %s", secret.Name)
 
 	return nil
 }
 
+func getDatabaseUserSecret(ctx context.Context, client ctrl.Reader, namespace string, databaseName string) (*v1.Secret, error) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      databaseName,
+			Namespace: namespace,
+		},
+	}
+
+	if err := client.Get(ctx, ctrl.ObjectKeyFromObject(secret), secret); err != nil {
+		return nil, &UnleashError{Err: err, Reason: "failed to get database user secret"}
+	}
+
+	return secret, nil
+}
+
 func deleteDatabaseUserSecret(ctx context.Context, client ctrl.Client, namespace string, databaseName string) error {
 	secret := &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -131,6 +176,7 @@ func deleteDatabaseUserSecret(ctx context.Context, client ctrl.Client, namespace
 	if err := client.Delete(ctx, secret); err != nil {
 		return &UnleashError{Err: err, Reason: "failed to delete database user secret"}
 	}
+	logging.FromContext(ctx).Infof("Deleted database user secret %s", databaseName)
 
 	return nil
 }
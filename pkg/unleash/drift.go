@@ -0,0 +1,175 @@
+package unleash
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+
+	"github.com/nais/bifrost/pkg/config"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DriftField is a single field where the live Unleash spec differs from the
+// spec rendered by UnleashDefinition.
+type DriftField struct {
+	Path    string `json:"path"`
+	Live    string `json:"live"`
+	Desired string `json:"desired"`
+}
+
+// SpecDrift compares the spec of a live Unleash server with the spec the
+// current UnleashDefinition would render for the same configuration, and
+// returns the fields that differ.
+func SpecDrift(c *config.Config, server *unleashv1.Unleash) ([]DriftField, error) {
+	desired := UnleashDefinition(c, UnleashVariables(server, true))
+
+	liveSpec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&server.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	desiredSpec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&desired.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []DriftField{}
+	diffValues("spec", liveSpec, desiredSpec, &fields)
+
+	return fields, nil
+}
+
+func diffValues(path string, live, desired interface{}, fields *[]DriftField) {
+	if isEmptyValue(live) && isEmptyValue(desired) {
+		return
+	}
+
+	switch l := live.(type) {
+	case map[string]interface{}:
+		d, ok := desired.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		for _, key := range unionKeys(l, d) {
+			diffValues(fmt.Sprintf("%s.%s", path, key), l[key], d[key], fields)
+		}
+		return
+	case []interface{}:
+		d, ok := desired.([]interface{})
+		if !ok {
+			break
+		}
+
+		if isNamedList(l) && isNamedList(d) {
+			desiredByName, names := namedListToMap(d, nil)
+			liveByName, names := namedListToMap(l, names)
+
+			for _, name := range names {
+				diffValues(fmt.Sprintf("%s[%s]", path, name), liveByName[name], desiredByName[name], fields)
+			}
+			return
+		}
+
+		for i := 0; i < len(l) || i < len(d); i++ {
+			var liveItem, desiredItem interface{}
+			if i < len(l) {
+				liveItem = l[i]
+			}
+			if i < len(d) {
+				desiredItem = d[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), liveItem, desiredItem, fields)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(live, desired) {
+		*fields = append(*fields, DriftField{
+			Path:    path,
+			Live:    formatDriftValue(live),
+			Desired: formatDriftValue(desired),
+		})
+	}
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	seen := map[string]bool{}
+	keys := []string{}
+
+	for _, m := range []map[string]interface{}{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// isNamedList reports whether all items in the list are objects with a name,
+// such as environment variables and containers.
+func isNamedList(list []interface{}) bool {
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"].(string); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func namedListToMap(list []interface{}, names []string) (map[string]interface{}, []string) {
+	byName := map[string]interface{}{}
+
+	for _, item := range list {
+		name := item.(map[string]interface{})["name"].(string)
+		if _, ok := byName[name]; !ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+		byName[name] = item
+	}
+
+	return byName, names
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+
+	return false
+}
+
+func formatDriftValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,87 @@
+package unleash
+
+import (
+	"testing"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSpecDrift(t *testing.T) {
+	c := &config.Config{
+		CloudConnectorProxy: "gcr.io/cloud-sql-connectors/cloud-sql-proxy:2.1.0",
+	}
+	uc := &UnleashConfig{
+		Name:                      "my-instance",
+		CustomVersion:             "v1.2.3-00000000-000000-abcd1234",
+		EnableFederation:          true,
+		FederationNonce:           "abc123",
+		AllowedTeams:              "team-a,team-b",
+		AllowedNamespaces:         "team-a,team-b",
+		AllowedClusters:           "cluster-a,cluster-b",
+		LogLevel:                  "debug",
+		DatabasePoolMax:           10,
+		DatabasePoolIdleTimeoutMs: 100,
+	}
+
+	t.Run("should not report drift for an up to date server", func(t *testing.T) {
+		server := UnleashDefinition(c, uc)
+
+		drift, err := SpecDrift(c, &server)
+		assert.NoError(t, err)
+		assert.Empty(t, drift)
+	})
+
+	t.Run("should report changed definition constants", func(t *testing.T) {
+		server := UnleashDefinition(c, uc)
+		newConfig := &config.Config{
+			CloudConnectorProxy: "gcr.io/cloud-sql-connectors/cloud-sql-proxy:2.2.0",
+		}
+
+		drift, err := SpecDrift(newConfig, &server)
+		assert.NoError(t, err)
+		assert.Equal(t, []DriftField{
+			{
+				Path:    "spec.extraContainers[sql-proxy].image",
+				Live:    "gcr.io/cloud-sql-connectors/cloud-sql-proxy:2.1.0",
+				Desired: "gcr.io/cloud-sql-connectors/cloud-sql-proxy:2.2.0",
+			},
+		}, drift)
+	})
+
+	t.Run("should report missing and unknown env vars", func(t *testing.T) {
+		server := UnleashDefinition(c, uc)
+		envVars := []corev1.EnvVar{}
+		for _, envVar := range server.Spec.ExtraEnvVars {
+			if envVar.Name != "GOOGLE_IAP_AUDIENCE" {
+				envVars = append(envVars, envVar)
+			}
+		}
+		server.Spec.ExtraEnvVars = append(envVars, corev1.EnvVar{Name: "MY_ENV_VAR", Value: "foo"})
+
+		drift, err := SpecDrift(c, &server)
+		assert.NoError(t, err)
+		assert.Equal(t, []DriftField{
+			{
+				Path:    "spec.extraEnvVars[GOOGLE_IAP_AUDIENCE]",
+				Live:    "",
+				Desired: `{"name":"GOOGLE_IAP_AUDIENCE","value":"/projects//global/backendServices/"}`,
+			},
+			{
+				Path:    "spec.extraEnvVars[MY_ENV_VAR]",
+				Live:    `{"name":"MY_ENV_VAR","value":"foo"}`,
+				Desired: "",
+			},
+		}, drift)
+	})
+
+	t.Run("should report changed resources", func(t *testing.T) {
+		server := UnleashDefinition(c, uc)
+		server.Spec.Size = 2
+
+		drift, err := SpecDrift(c, &server)
+		assert.NoError(t, err)
+		assert.Equal(t, []DriftField{{Path: "spec.size", Live: "2", Desired: "1"}}, drift)
+	})
+}
@@ -1,5 +1,15 @@
 package unleash
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
 type UnleashError struct {
 	Reason string
 	Err    error
@@ -8,3 +18,80 @@ type UnleashError struct {
 func (e *UnleashError) Error() string {
 	return e.Reason
 }
+
+func (e *UnleashError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned when a config value is rejected by a check
+// that needs more than the config itself, such as looking up the custom image.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Key: 'UnleashConfig.%s' Error:%s", e.Field, e.Reason)
+}
+
+// ErrInstanceNotFound is returned when none of the resources of an Unleash
+// instance exist.
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// ErrServerNotRepairable is returned by Repair when the Unleash server is
+// missing, as its configuration is lost with it.
+var ErrServerNotRepairable = errors.New("the Unleash server can not be recreated without its configuration")
+
+// ProvisionError is returned when one of the steps of provisioning an Unleash
+// instance fails. It records which step failed and which of the previously
+// created resources were rolled back.
+type ProvisionError struct {
+	Step          string
+	Err           error
+	RolledBack    []string
+	NotRolledBack []string
+	RollbackErr   error
+}
+
+func (e *ProvisionError) Error() string {
+	msg := fmt.Sprintf("failed to provision %s", e.Step)
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %s", msg, e.Err)
+	}
+
+	if len(e.RolledBack) > 0 {
+		msg = fmt.Sprintf("%s (rolled back: %s)", msg, strings.Join(e.RolledBack, ", "))
+	}
+
+	if len(e.NotRolledBack) > 0 {
+		msg = fmt.Sprintf("%s (rollback failed: %s)", msg, strings.Join(e.NotRolledBack, ", "))
+	}
+
+	return msg
+}
+
+func (e *ProvisionError) Unwrap() []error {
+	return []error{e.Err, e.RollbackErr}
+}
+
+// IsNotFound reports whether err is a not found error from either the Cloud
+// SQL Admin API or the Kubernetes API.
+func IsNotFound(err error) bool {
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return googleErr.Code == http.StatusNotFound
+	}
+
+	return apierrors.IsNotFound(err)
+}
+
+// IsAlreadyExists reports whether err is a conflict error from either the
+// Cloud SQL Admin API or the Kubernetes API.
+func IsAlreadyExists(err error) bool {
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return googleErr.Code == http.StatusConflict
+	}
+
+	return apierrors.IsAlreadyExists(err)
+}
@@ -0,0 +1,159 @@
+package unleash
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// InstanceEvent is a Kubernetes event for one of the objects belonging to an
+// instance. Repeated events for the same object are merged.
+type InstanceEvent struct {
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Object    string    `json:"object"`
+	Source    string    `json:"source"`
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+}
+
+// instanceLabels are the labels Unleasherator sets on the resources it
+// creates for an instance.
+func instanceLabels(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/instance":   name,
+		"app.kubernetes.io/part-of":    "unleasherator",
+		"app.kubernetes.io/name":       "Unleash",
+		"app.kubernetes.io/created-by": "controller-manager",
+	}
+}
+
+// listServerEvents returns the events for the Unleash server, its network
+// policy and the Deployments, ReplicaSets and Pods labelled with the instance
+// name, newest first.
+func listServerEvents(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string) ([]InstanceEvent, error) {
+	objects := map[string]bool{
+		"Unleash/" + name:                     true,
+		"FQDNNetworkPolicy/" + name + "-fqdn": true,
+	}
+
+	selector := []ctrl.ListOption{ctrl.InNamespace(kubeNamespace), ctrl.MatchingLabels(instanceLabels(name))}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := kubeClient.List(ctx, deployments, selector...); err != nil {
+		return nil, &UnleashError{Err: err, Reason: "failed to list deployments"}
+	}
+	for _, deployment := range deployments.Items {
+		objects["Deployment/"+deployment.Name] = true
+	}
+
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := kubeClient.List(ctx, replicaSets, selector...); err != nil {
+		return nil, &UnleashError{Err: err, Reason: "failed to list replica sets"}
+	}
+	for _, replicaSet := range replicaSets.Items {
+		objects["ReplicaSet/"+replicaSet.Name] = true
+	}
+
+	pods := &corev1.PodList{}
+	if err := kubeClient.List(ctx, pods, selector...); err != nil {
+		return nil, &UnleashError{Err: err, Reason: "failed to list pods"}
+	}
+	for _, pod := range pods.Items {
+		objects["Pod/"+pod.Name] = true
+	}
+
+	events := &corev1.EventList{}
+	if err := kubeClient.List(ctx, events, ctrl.InNamespace(kubeNamespace)); err != nil {
+		return nil, &UnleashError{Err: err, Reason: "failed to list events"}
+	}
+
+	merged := map[string]*InstanceEvent{}
+	for _, event := range events.Items {
+		object := fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name)
+		if !objects[object] {
+			continue
+		}
+
+		e := newInstanceEvent(object, event)
+		key := fmt.Sprintf("%s|%s|%s|%s", e.Object, e.Type, e.Reason, e.Message)
+
+		existing, ok := merged[key]
+		if !ok {
+			merged[key] = &e
+			continue
+		}
+
+		existing.Count += e.Count
+		if e.FirstSeen.Before(existing.FirstSeen) {
+			existing.FirstSeen = e.FirstSeen
+		}
+		if e.LastSeen.After(existing.LastSeen) {
+			existing.LastSeen = e.LastSeen
+		}
+	}
+
+	timeline := make([]InstanceEvent, 0, len(merged))
+	for _, event := range merged {
+		timeline = append(timeline, *event)
+	}
+
+	slices.SortFunc(timeline, func(a, b InstanceEvent) int {
+		if c := b.LastSeen.Compare(a.LastSeen); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Object, b.Object)
+	})
+
+	return timeline, nil
+}
+
+// newInstanceEvent converts an event. Events created through the events.k8s.io
+// API only set the event time and series, so those are used as fallbacks.
+func newInstanceEvent(object string, event corev1.Event) InstanceEvent {
+	e := InstanceEvent{
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Message:   event.Message,
+		Object:    object,
+		Source:    event.Source.Component,
+		Count:     event.Count,
+		FirstSeen: event.FirstTimestamp.Time,
+		LastSeen:  event.LastTimestamp.Time,
+	}
+
+	if e.Source == "" {
+		e.Source = event.ReportingController
+	}
+
+	if e.FirstSeen.IsZero() {
+		e.FirstSeen = event.EventTime.Time
+	}
+
+	if e.LastSeen.IsZero() {
+		e.LastSeen = e.FirstSeen
+		if event.Series != nil {
+			e.LastSeen = event.Series.LastObservedTime.Time
+		}
+	}
+
+	if e.Count == 0 {
+		e.Count = 1
+		if event.Series != nil {
+			e.Count = event.Series.Count
+		}
+	}
+
+	e.FirstSeen = e.FirstSeen.UTC()
+	e.LastSeen = e.LastSeen.UTC()
+
+	return e
+}
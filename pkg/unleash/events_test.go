@@ -0,0 +1,78 @@
+package unleash
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestUnleashServiceEvents(t *testing.T) {
+	at := func(minute int) metav1.Time {
+		return metav1.NewTime(time.Date(2024, 1, 2, 3, minute, 0, 0, time.UTC))
+	}
+
+	event := func(name, kind, object, eventType, reason, message string, first, last int) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "unleash"},
+			InvolvedObject: corev1.ObjectReference{Kind: kind, Name: object, Namespace: "unleash"},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        message,
+			Source:         corev1.EventSource{Component: "kubelet"},
+			Count:          1,
+			FirstTimestamp: at(first),
+			LastTimestamp:  at(last),
+		}
+	}
+
+	objectMeta := func(name, instance string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "unleash", Labels: instanceLabels(instance)}
+	}
+
+	objs := []ctrl.Object{
+		&appsv1.Deployment{ObjectMeta: objectMeta("my-instance", "my-instance")},
+		&appsv1.ReplicaSet{ObjectMeta: objectMeta("my-instance-5d4f", "my-instance")},
+		&corev1.Pod{ObjectMeta: objectMeta("my-instance-5d4f-abcde", "my-instance")},
+		&corev1.Pod{ObjectMeta: objectMeta("other-5d4f-abcde", "other")},
+
+		event("e1", "Unleash", "my-instance", corev1.EventTypeNormal, "AutoUpgraded", "Upgraded", 1, 1),
+		event("e2", "Deployment", "my-instance", corev1.EventTypeNormal, "ScalingReplicaSet", "Scaled up", 2, 2),
+		event("e3", "Pod", "my-instance-5d4f-abcde", corev1.EventTypeWarning, "BackOff", "Back-off restarting failed container", 3, 5),
+		event("e4", "Pod", "my-instance-5d4f-abcde", corev1.EventTypeWarning, "BackOff", "Back-off restarting failed container", 4, 9),
+		event("e5", "Pod", "other-5d4f-abcde", corev1.EventTypeWarning, "BackOff", "Back-off restarting failed container", 3, 8),
+		event("e6", "FQDNNetworkPolicy", "my-instance-fqdn", corev1.EventTypeNormal, "Created", "Created", 0, 0),
+		&corev1.Event{
+			ObjectMeta:          metav1.ObjectMeta{Name: "e7", Namespace: "unleash"},
+			InvolvedObject:      corev1.ObjectReference{Kind: "ReplicaSet", Name: "my-instance-5d4f", Namespace: "unleash"},
+			Type:                corev1.EventTypeNormal,
+			Reason:              "SuccessfulCreate",
+			Message:             "Created pod",
+			ReportingController: "replicaset-controller",
+			EventTime:           metav1.NewMicroTime(at(6).Time),
+			Series:              &corev1.EventSeries{Count: 2, LastObservedTime: metav1.NewMicroTime(at(7).Time)},
+		},
+	}
+
+	service, _ := newTestService(t, newFakeSQLAdmin(), interceptor.Funcs{}, objs...)
+
+	events, err := service.Events(context.Background(), "my-instance")
+	assert.NoError(t, err)
+	assert.Equal(t, []InstanceEvent{
+		{Type: "Warning", Reason: "BackOff", Message: "Back-off restarting failed container", Object: "Pod/my-instance-5d4f-abcde", Source: "kubelet", Count: 2, FirstSeen: at(3).Time, LastSeen: at(9).Time},
+		{Type: "Normal", Reason: "SuccessfulCreate", Message: "Created pod", Object: "ReplicaSet/my-instance-5d4f", Source: "replicaset-controller", Count: 2, FirstSeen: at(6).Time, LastSeen: at(7).Time},
+		{Type: "Normal", Reason: "ScalingReplicaSet", Message: "Scaled up", Object: "Deployment/my-instance", Source: "kubelet", Count: 1, FirstSeen: at(2).Time, LastSeen: at(2).Time},
+		{Type: "Normal", Reason: "AutoUpgraded", Message: "Upgraded", Object: "Unleash/my-instance", Source: "kubelet", Count: 1, FirstSeen: at(1).Time, LastSeen: at(1).Time},
+		{Type: "Normal", Reason: "Created", Message: "Created", Object: "FQDNNetworkPolicy/my-instance-fqdn", Source: "kubelet", Count: 1, FirstSeen: at(0).Time, LastSeen: at(0).Time},
+	}, events)
+
+	events, err = service.Events(context.Background(), "missing")
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,56 @@
+package unleash
+
+import (
+	"context"
+	"time"
+
+	"github.com/nais/bifrost/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// RunFleetMetrics exports the state of all Unleash instances as Prometheus
+// gauges, refreshing them every interval until ctx is cancelled.
+func RunFleetMetrics(ctx context.Context, service IUnleashService, interval time.Duration, logger *logrus.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := collectFleetMetrics(ctx, service); err != nil {
+			logger.WithError(err).Error("Error collecting Unleash fleet metrics")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func collectFleetMetrics(ctx context.Context, service IUnleashService) error {
+	instances, err := service.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	fleet := make([]metrics.FleetInstance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.ServerInstance == nil {
+			continue
+		}
+
+		uc := UnleashVariables(instance.ServerInstance, true)
+		fleet = append(fleet, metrics.FleetInstance{
+			Name:              instance.Name,
+			Version:           instance.Version(),
+			CustomImage:       instance.ServerInstance.Spec.CustomImage,
+			Ready:             instance.IsReady(),
+			FederationEnabled: instance.ServerInstance.Spec.Federation.Enabled,
+			DatabasePoolMax:   uc.DatabasePoolMax,
+		})
+	}
+
+	metrics.SetFleet(fleet)
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package unleash
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/metrics"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestCollectFleetMetrics(t *testing.T) {
+	c := &config.Config{Unleash: config.UnleashConfig{InstanceNamespace: "unleash"}}
+
+	ready := UnleashDefinition(c, &UnleashConfig{Name: "ready", EnableFederation: true, DatabasePoolMax: 5, CustomVersion: "v5.10.2-20240329-070801-0180a96"})
+	ready.Status.Version = "5.10.2"
+	ready.Status.Conditions = []metav1.Condition{
+		{Type: unleashv1.UnleashStatusConditionTypeReconciled, Status: metav1.ConditionTrue},
+		{Type: unleashv1.UnleashStatusConditionTypeConnected, Status: metav1.ConditionTrue},
+	}
+
+	notReady := UnleashDefinition(c, &UnleashConfig{Name: "not-ready", DatabasePoolMax: 3})
+
+	service, _ := newTestService(t, newFakeSQLAdmin(), interceptor.Funcs{}, &ready, &notReady)
+
+	assert.NoError(t, collectFleetMetrics(context.Background(), service))
+
+	expected := `
+# HELP bifrost_unleash_instance_ready Whether the Unleash instance is ready (1) or not (0).
+# TYPE bifrost_unleash_instance_ready gauge
+bifrost_unleash_instance_ready{name="not-ready"} 0
+bifrost_unleash_instance_ready{name="ready"} 1
+# HELP bifrost_unleash_instance_info Version and image of the Unleash instance, always 1.
+# TYPE bifrost_unleash_instance_info gauge
+bifrost_unleash_instance_info{custom_image="",name="not-ready",version=""} 1
+bifrost_unleash_instance_info{custom_image="europe-north1-docker.pkg.dev/nais-io/nais/images/unleash-v4:v5.10.2-20240329-070801-0180a96",name="ready",version="5.10.2"} 1
+# HELP bifrost_unleash_instance_federation_enabled Whether federation is enabled (1) or not (0) for the Unleash instance.
+# TYPE bifrost_unleash_instance_federation_enabled gauge
+bifrost_unleash_instance_federation_enabled{name="not-ready"} 0
+bifrost_unleash_instance_federation_enabled{name="ready"} 1
+# HELP bifrost_unleash_instance_database_pool_max Configured maximum database pool size of the Unleash instance.
+# TYPE bifrost_unleash_instance_database_pool_max gauge
+bifrost_unleash_instance_database_pool_max{name="not-ready"} 3
+bifrost_unleash_instance_database_pool_max{name="ready"} 5
+`
+
+	assert.NoError(t, testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected),
+		"bifrost_unleash_instance_ready",
+		"bifrost_unleash_instance_info",
+		"bifrost_unleash_instance_federation_enabled",
+		"bifrost_unleash_instance_database_pool_max",
+	))
+}
@@ -3,6 +3,8 @@ package unleash
 import (
 	"context"
 	"fmt"
+	"slices"
+	"time"
 
 	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
 	"github.com/nais/bifrost/pkg/config"
@@ -63,16 +65,10 @@ func (u *UnleashInstance) IsReady() bool {
 	}
 }
 
-func (u *UnleashInstance) Status() string {
-	if u.ServerInstance != nil {
-		if u.ServerInstance.IsReady() {
-			return "Ready"
-		} else {
-			return "Not ready"
-		}
-	} else {
-		return "Status unknown"
-	}
+// Status derives the state of the instance from the conditions of the
+// Unleash resource.
+func (u *UnleashInstance) Status() Status {
+	return serverStatus(u.ServerInstance)
 }
 
 func (u *UnleashInstance) Version() string {
@@ -84,15 +80,7 @@ func (u *UnleashInstance) Version() string {
 }
 
 func (u *UnleashInstance) StatusLabel() string {
-	if u.ServerInstance != nil {
-		if u.ServerInstance.IsReady() {
-			return "green"
-		} else {
-			return "red"
-		}
-	} else {
-		return "orange"
-	}
+	return u.Status().Label()
 }
 
 func (u *UnleashInstance) GetDatabase(ctx context.Context, client *admin.DatabasesService) error {
@@ -117,7 +105,7 @@ func (u *UnleashInstance) GetDatabaseUser(ctx context.Context, client *admin.Use
 	return nil
 }
 
-func getServer(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string) (*unleashv1.Unleash, error) {
+func getServer(ctx context.Context, kubeClient ctrl.Reader, kubeNamespace string, name string) (*unleashv1.Unleash, error) {
 	unleashDefinition := unleashv1.Unleash{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: kubeNamespace}}
 	err := kubeClient.Get(ctx, ctrl.ObjectKeyFromObject(&unleashDefinition), &unleashDefinition)
 	if err != nil {
@@ -154,6 +142,17 @@ func updateServer(ctx context.Context, kubeClient ctrl.Client, config *config.Co
 	unleashDefinitionNew.ObjectMeta.Generation = unleashDefinitionOld.ObjectMeta.Generation
 	unleashDefinitionNew.ObjectMeta.UID = unleashDefinitionOld.ObjectMeta.UID
 
+	// Keep annotations added by others, e.g. kubectl or Unleasherator
+	for key, value := range unleashDefinitionOld.GetAnnotations() {
+		if slices.Contains(bifrostAnnotations, key) {
+			continue
+		}
+		if unleashDefinitionNew.ObjectMeta.Annotations == nil {
+			unleashDefinitionNew.ObjectMeta.Annotations = map[string]string{}
+		}
+		unleashDefinitionNew.ObjectMeta.Annotations[key] = value
+	}
+
 	if err := kubeClient.Update(ctx, &unleashDefinitionNew); err != nil {
 		return nil, &UnleashError{Err: err, Reason: "failed to update server instance"}
 	}
@@ -161,7 +160,7 @@ func updateServer(ctx context.Context, kubeClient ctrl.Client, config *config.Co
 	return &unleashDefinitionNew, nil
 }
 
-func getFQDNNetworkPolicy(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string) (*fqdnV1alpha3.FQDNNetworkPolicy, error) {
+func getFQDNNetworkPolicy(ctx context.Context, kubeClient ctrl.Reader, kubeNamespace string, name string) (*fqdnV1alpha3.FQDNNetworkPolicy, error) {
 	fqdn := fqdnV1alpha3.FQDNNetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-fqdn", name), Namespace: kubeNamespace}}
 	if err := kubeClient.Get(ctx, ctrl.ObjectKeyFromObject(&fqdn), &fqdn); err != nil {
 		return nil, &UnleashError{Err: err, Reason: "failed to get fqdn network policy"}
@@ -203,3 +202,33 @@ func updateFQDNNetworkPolicy(ctx context.Context, kubeClient ctrl.Client, kubeNa
 
 	return nil
 }
+
+func createServerEvent(ctx context.Context, kubeClient ctrl.Client, server *unleashv1.Unleash, eventType, reason, message string) error {
+	now := metav1.NewTime(time.Now())
+	event := corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", server.GetName(), now.UnixNano()),
+			Namespace: server.GetNamespace(),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Unleash",
+			APIVersion:      unleashv1.GroupVersion.String(),
+			Name:            server.GetName(),
+			Namespace:       server.GetNamespace(),
+			UID:             server.GetUID(),
+			ResourceVersion: server.GetResourceVersion(),
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: "bifrost"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if err := kubeClient.Create(ctx, &event); err != nil {
+		return &UnleashError{Err: err, Reason: "failed to create event"}
+	}
+	return nil
+}
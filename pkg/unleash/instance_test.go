@@ -164,15 +164,15 @@ func TestUnleashInstance_Status(t *testing.T) {
 		},
 	}
 	got := instance.Status()
-	assert.Equal(t, "Ready", got)
+	assert.Equal(t, StatusReady, got)
 
 	instance.ServerInstance.Status.Conditions[0].Status = metav1.ConditionFalse
 	got = instance.Status()
-	assert.Equal(t, "Not ready", got)
+	assert.Equal(t, StatusFailed, got)
 
 	instance.ServerInstance = nil
 	got = instance.Status()
-	assert.Equal(t, "Status unknown", got)
+	assert.Equal(t, StatusUnknown, got)
 }
 
 func TestUnleashInstance_StatusLabel(t *testing.T) {
@@ -0,0 +1,146 @@
+package unleash
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// UnleashContainer is the container Unleasherator runs Unleash in.
+	UnleashContainer = "unleash"
+	// SQLProxyContainer is the Cloud SQL proxy sidecar added by
+	// UnleashDefinition.
+	SQLProxyContainer = "sql-proxy"
+
+	// DefaultLogTailLines is the number of lines returned when no tail is
+	// given.
+	DefaultLogTailLines int64 = 500
+	// MaxLogTailLines is the largest tail that can be requested.
+	MaxLogTailLines int64 = 10000
+)
+
+// LogContainers are the containers whose logs can be read.
+var LogContainers = []string{UnleashContainer, SQLProxyContainer}
+
+var (
+	// ErrLogsUnavailable is returned when the service cannot read pod logs.
+	ErrLogsUnavailable = errors.New("pod logs are not available")
+	// ErrLogTargetNotFound is returned when the pod or container does not
+	// belong to the instance.
+	ErrLogTargetNotFound = errors.New("pod or container not found")
+)
+
+// LogStreamer opens the log stream of a container.
+type LogStreamer interface {
+	Logs(ctx context.Context, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error)
+}
+
+type podLogStreamer struct {
+	pods corev1client.PodsGetter
+}
+
+// NewLogStreamer reads logs through the pods API.
+func NewLogStreamer(pods corev1client.PodsGetter) LogStreamer {
+	return &podLogStreamer{pods: pods}
+}
+
+func (p *podLogStreamer) Logs(ctx context.Context, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	return p.pods.Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+}
+
+// InstancePod is a pod running an instance.
+type InstancePod struct {
+	Name      string    `json:"name"`
+	Phase     string    `json:"phase"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+// LogOptions select the logs to read. An empty pod is the newest pod of the
+// instance.
+type LogOptions struct {
+	Pod       string
+	Container string
+	TailLines int64
+	Follow    bool
+}
+
+func listServerPods(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string) ([]InstancePod, error) {
+	pods := &corev1.PodList{}
+	if err := kubeClient.List(ctx, pods, ctrl.InNamespace(kubeNamespace), ctrl.MatchingLabels(instanceLabels(name))); err != nil {
+		return nil, &UnleashError{Err: err, Reason: "failed to list pods"}
+	}
+
+	instancePods := []InstancePod{}
+	for _, pod := range pods.Items {
+		instancePods = append(instancePods, InstancePod{
+			Name:      pod.Name,
+			Phase:     string(pod.Status.Phase),
+			CreatedAt: pod.CreationTimestamp.Time,
+		})
+	}
+
+	slices.SortFunc(instancePods, func(a, b InstancePod) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return instancePods, nil
+}
+
+// streamServerLogs opens the logs of a container in one of the pods of the
+// instance. Pods and containers that do not belong to the instance are
+// rejected, so users can only read the logs of instances they can access.
+func streamServerLogs(ctx context.Context, kubeClient ctrl.Client, logs LogStreamer, kubeNamespace string, name string, opts LogOptions) (io.ReadCloser, error) {
+	if logs == nil {
+		return nil, ErrLogsUnavailable
+	}
+
+	container := opts.Container
+	if container == "" {
+		container = UnleashContainer
+	}
+	if !slices.Contains(LogContainers, container) {
+		return nil, fmt.Errorf("%w: container %s", ErrLogTargetNotFound, container)
+	}
+
+	pods, err := listServerPods(ctx, kubeClient, kubeNamespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(pods, func(pod InstancePod) bool {
+		return opts.Pod == "" || pod.Name == opts.Pod
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("%w: pod %s", ErrLogTargetNotFound, opts.Pod)
+	}
+
+	tailLines := opts.TailLines
+	if tailLines <= 0 {
+		tailLines = DefaultLogTailLines
+	}
+	tailLines = min(tailLines, MaxLogTailLines)
+
+	stream, err := logs.Logs(ctx, kubeNamespace, pods[i].Name, &corev1.PodLogOptions{
+		Container:  container,
+		TailLines:  &tailLines,
+		Follow:     opts.Follow,
+		Timestamps: true,
+	})
+	if err != nil {
+		return nil, &UnleashError{Err: err, Reason: "failed to read pod logs"}
+	}
+
+	return stream, nil
+}
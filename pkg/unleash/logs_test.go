@@ -0,0 +1,98 @@
+package unleash
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+type fakeLogStreamer struct {
+	namespace, pod string
+	opts           *corev1.PodLogOptions
+}
+
+func (f *fakeLogStreamer) Logs(ctx context.Context, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	f.namespace, f.pod, f.opts = namespace, pod, opts
+	return io.NopCloser(strings.NewReader("line 1\nline 2\n")), nil
+}
+
+func TestUnleashServiceLogs(t *testing.T) {
+	ctx := context.Background()
+
+	pod := func(name, instance string, created time.Time) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "unleash",
+				Labels:            instanceLabels(instance),
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+
+	now := time.Now().Truncate(time.Second)
+	objs := []ctrl.Object{
+		pod("my-instance-old", "my-instance", now.Add(-time.Hour)),
+		pod("my-instance-new", "my-instance", now),
+		pod("other-abc", "other", now),
+	}
+
+	service, _ := newTestService(t, newFakeSQLAdmin(), interceptor.Funcs{}, objs...)
+
+	_, err := service.Logs(ctx, "my-instance", LogOptions{})
+	assert.ErrorIs(t, err, ErrLogsUnavailable)
+
+	logs := &fakeLogStreamer{}
+	service.logStreamer = logs
+
+	pods, err := service.Pods(ctx, "my-instance")
+	assert.NoError(t, err)
+	assert.Equal(t, []InstancePod{
+		{Name: "my-instance-new", Phase: "Running", CreatedAt: now},
+		{Name: "my-instance-old", Phase: "Running", CreatedAt: now.Add(-time.Hour)},
+	}, pods)
+
+	stream, err := service.Logs(ctx, "my-instance", LogOptions{})
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(stream)
+	assert.Equal(t, "line 1\nline 2\n", string(body))
+	assert.Equal(t, "unleash", logs.namespace)
+	assert.Equal(t, "my-instance-new", logs.pod)
+	assert.Equal(t, UnleashContainer, logs.opts.Container)
+	assert.Equal(t, DefaultLogTailLines, *logs.opts.TailLines)
+	assert.False(t, logs.opts.Follow)
+
+	_, err = service.Logs(ctx, "my-instance", LogOptions{Pod: "my-instance-old", Container: SQLProxyContainer, TailLines: 50000, Follow: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "my-instance-old", logs.pod)
+	assert.Equal(t, SQLProxyContainer, logs.opts.Container)
+	assert.Equal(t, MaxLogTailLines, *logs.opts.TailLines)
+	assert.True(t, logs.opts.Follow)
+
+	_, err = service.Logs(ctx, "my-instance", LogOptions{Pod: "other-abc"})
+	assert.ErrorIs(t, err, ErrLogTargetNotFound)
+
+	_, err = service.Logs(ctx, "my-instance", LogOptions{Container: "istio-proxy"})
+	assert.ErrorIs(t, err, ErrLogTargetNotFound)
+}
+
+func TestLogStreamer(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	stream, err := NewLogStreamer(clientset.CoreV1()).Logs(context.Background(), "unleash", "my-instance-abc", &corev1.PodLogOptions{Container: UnleashContainer})
+	assert.NoError(t, err)
+	defer stream.Close()
+
+	body, _ := io.ReadAll(stream)
+	assert.Equal(t, "fake logs", string(body))
+}
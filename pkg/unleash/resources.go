@@ -2,6 +2,7 @@ package unleash
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -31,10 +32,28 @@ const (
 	DatabasePoolMax           = "3"
 	DatabasePoolIdleTimeoutMs = "1000"
 	LogLevel                  = "warn"
+
+	CustomImageDigestAnnotation = "bifrost.nais.io/custom-image-digest"
+	UpgradeChannelAnnotation    = "bifrost.nais.io/upgrade-channel"
+)
+
+// Upgrade channels decide how the auto-upgrader moves an instance forward.
+// Instances without a channel are pinned.
+const (
+	UpgradeChannelPinned    = "pinned"
+	UpgradeChannelAutoPatch = "auto-patch"
+	UpgradeChannelAutoMinor = "auto-minor"
 )
 
+// bifrostAnnotations are the annotations UnleashDefinition owns on the server.
+var bifrostAnnotations = []string{CustomImageDigestAnnotation, UpgradeChannelAnnotation}
+
 var FederationAllowedClusters = []string{"dev-gcp", "prod-gcp"}
 
+// ReservedNames cannot be used for instances, as their pages would be shadowed
+// by the routes of the same name under /unleash.
+var ReservedNames = []string{"stream", "upgrade"}
+
 func boolRef(b bool) *bool {
 	boolVar := b
 	return &boolVar
@@ -59,12 +78,7 @@ func FQDNNetworkPolicyDefinition(name string, kubeNamespace string) fqdnV1alpha3
 		},
 		Spec: fqdnV1alpha3.FQDNNetworkPolicySpec{
 			PodSelector: metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app.kubernetes.io/instance":   name,
-					"app.kubernetes.io/part-of":    "unleasherator",
-					"app.kubernetes.io/name":       "Unleash",
-					"app.kubernetes.io/created-by": "controller-manager",
-				},
+				MatchLabels: instanceLabels(name),
 			},
 			Egress: []fqdnV1alpha3.FQDNNetworkPolicyEgressRule{
 				{
@@ -106,6 +120,14 @@ func customImageForVersion(customVersion string) string {
 	return fmt.Sprintf("%s%s:%s", UnleashCustomImageRepo, UnleashCustomImageName, customVersion)
 }
 
+// CustomImageRegistry splits the custom Unleash image into the URL of its
+// registry and its repository in that registry, e.g.
+// "nais-io/nais/images/unleash-v4".
+func CustomImageRegistry() (registryUrl, repository string) {
+	host, path, _ := strings.Cut(UnleashCustomImageRepo, "/")
+	return "https://" + host, path + UnleashCustomImageName
+}
+
 func versionFromImage(image string) string {
 	return strings.Split(image, ":")[1]
 }
@@ -124,16 +146,18 @@ func getServerEnvVar(server *unleashv1.Unleash, name, defaultValue string, retur
 }
 
 type UnleashConfig struct {
-	Name                      string `json:"name,omitempty" form:"name" validate:"required,hostname"`
+	Name                      string `json:"name,omitempty" form:"name" validate:"required,hostname,unreserved"`
 	CustomVersion             string `json:"custom-version,omitempty" form:"custom-version" validate:"omitempty"`
 	EnableFederation          bool   `json:"enable-federation,omitempty" form:"enable-federation,default=true"`
 	FederationNonce           string `json:"-" form:"-" validate:"required"`
-	AllowedTeams              string `json:"allowed-teams,omitempty" form:"allowed-teams" validate:"omitempty"`
-	AllowedNamespaces         string `json:"allowed-namespaces,omitempty" form:"allowed-namespaces" validate:"omitempty"`
+	AllowedTeams              string `json:"allowed-teams,omitempty" form:"allowed-teams" validate:"omitempty,teams"`
+	AllowedNamespaces         string `json:"allowed-namespaces,omitempty" form:"allowed-namespaces" validate:"omitempty,teams"`
 	AllowedClusters           string `json:"allowed-clusters,omitempty" form:"allowed-clusters" validate:"omitempty"`
 	LogLevel                  string `json:"log-level,omitempty" form:"loglevel,default=warn" validate:"required,oneof=debug info warn error fatal panic"`
 	DatabasePoolMax           int    `json:"database-pool-max,omitempty" form:"database-pool-max,default=3" validate:"required,min=1,max=10"`
 	DatabasePoolIdleTimeoutMs int    `json:"database-pool-idle-timeout-ms,omitempty" form:"database-pool-idle-timeout-ms,default=1000" validate:"required"`
+	UpgradeChannel            string `json:"upgrade-channel,omitempty" form:"upgrade-channel" validate:"omitempty,oneof=pinned auto-patch auto-minor"`
+	CustomImageDigest         string `json:"-" form:"-"`
 }
 
 func (uc *UnleashConfig) SetDefaultValues(unleashVersions []github.UnleashVersion) {
@@ -146,8 +170,8 @@ func (uc *UnleashConfig) SetDefaultValues(unleashVersions []github.UnleashVersio
 	if uc.DatabasePoolIdleTimeoutMs == 0 {
 		uc.DatabasePoolIdleTimeoutMs, _ = strconv.Atoi(DatabasePoolIdleTimeoutMs)
 	}
-	if uc.CustomVersion == "" && len(unleashVersions) > 0 {
-		uc.CustomVersion = unleashVersions[0].GitTag
+	if latest, ok := github.LatestUnleashVersion(unleashVersions); uc.CustomVersion == "" && ok {
+		uc.CustomVersion = latest.GitTag
 	}
 }
 
@@ -173,11 +197,40 @@ func (uc *UnleashConfig) MergeTeamsAndNamespaces() {
 	uc.AllowedNamespaces = strings.Join(result, ",")
 }
 
-func (uc *UnleashConfig) Validate() error {
+// Validate validates the config. When existingTeams is not nil, allowed teams
+// and namespaces must be one of the existing teams.
+func (uc *UnleashConfig) Validate(existingTeams []string) error {
 	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.RegisterValidation("teams", validateTeamsExist(existingTeams)); err != nil {
+		return err
+	}
+	if err := validate.RegisterValidation("unreserved", validateNameUnreserved); err != nil {
+		return err
+	}
+
 	return validate.Struct(uc)
 }
 
+func validateNameUnreserved(fl validator.FieldLevel) bool {
+	return !slices.Contains(ReservedNames, fl.Field().String())
+}
+
+func validateTeamsExist(existingTeams []string) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		if existingTeams == nil {
+			return true
+		}
+
+		for _, team := range utils.SplitNoEmpty(fl.Field().String(), ",") {
+			if !slices.Contains(existingTeams, strings.TrimSpace(team)) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
 func UnleashVariables(server *unleashv1.Unleash, returnDefaults bool) *UnleashConfig {
 	uc := &UnleashConfig{}
 
@@ -193,6 +246,7 @@ func UnleashVariables(server *unleashv1.Unleash, returnDefaults bool) *UnleashCo
 	uc.DatabasePoolMax, _ = strconv.Atoi(getServerEnvVar(server, "DATABASE_POOL_MAX", DatabasePoolMax, returnDefaults))
 	uc.DatabasePoolIdleTimeoutMs, _ = strconv.Atoi(getServerEnvVar(server, "DATABASE_POOL_IDLE_TIMEOUT_MS", DatabasePoolIdleTimeoutMs, returnDefaults))
 	uc.EnableFederation = server.Spec.Federation.Enabled
+	uc.UpgradeChannel = server.GetAnnotations()[UpgradeChannelAnnotation]
 	uc.AllowedNamespaces = utils.JoinNoEmpty(server.Spec.Federation.Namespaces, ",")
 	uc.AllowedClusters = utils.JoinNoEmpty(server.Spec.Federation.Clusters, ",")
 
@@ -300,7 +354,7 @@ func UnleashDefinition(c *config.Config, uc *UnleashConfig) unleashv1.Unleash {
 				Value: fmt.Sprintf("%d", uc.DatabasePoolIdleTimeoutMs),
 			}},
 			ExtraContainers: []corev1.Container{{
-				Name:  "sql-proxy",
+				Name:  SQLProxyContainer,
 				Image: c.CloudConnectorProxy,
 				Args: []string{
 					"--structured-logs",
@@ -345,5 +399,16 @@ func UnleashDefinition(c *config.Config, uc *UnleashConfig) unleashv1.Unleash {
 		server.Spec.CustomImage = customImageForVersion(uc.CustomVersion)
 	}
 
+	annotations := map[string]string{}
+	if uc.CustomImageDigest != "" {
+		annotations[CustomImageDigestAnnotation] = uc.CustomImageDigest
+	}
+	if uc.UpgradeChannel != "" {
+		annotations[UpgradeChannelAnnotation] = uc.UpgradeChannel
+	}
+	if len(annotations) > 0 {
+		server.ObjectMeta.Annotations = annotations
+	}
+
 	return server
 }
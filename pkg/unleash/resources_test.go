@@ -85,6 +85,13 @@ func TestCustomImageForVersion(t *testing.T) {
 	assert.Equal(t, expectedImage, customImageForVersion(customVersion))
 }
 
+func TestCustomImageRegistry(t *testing.T) {
+	registryUrl, repository := CustomImageRegistry()
+
+	assert.Equal(t, "https://europe-north1-docker.pkg.dev", registryUrl)
+	assert.Equal(t, "nais-io/nais/images/unleash-v4", repository)
+}
+
 func TestUnleashVariables(t *testing.T) {
 	c := &config.Config{}
 
@@ -99,7 +106,10 @@ func TestUnleashVariables(t *testing.T) {
 		LogLevel:                  "debug",
 		DatabasePoolMax:           10,
 		DatabasePoolIdleTimeoutMs: 100,
+		UpgradeChannel:            UpgradeChannelAutoPatch,
 	})
+	assert.Equal(t, UpgradeChannelAutoPatch, unleashInstance.Annotations[UpgradeChannelAnnotation])
+
 	uc := *UnleashVariables(&unleashInstance, true)
 	assert.Equal(t, UnleashConfig{
 		Name:                      "my-instance",
@@ -112,6 +122,7 @@ func TestUnleashVariables(t *testing.T) {
 		LogLevel:                  "debug",
 		DatabasePoolMax:           10,
 		DatabasePoolIdleTimeoutMs: 100,
+		UpgradeChannel:            UpgradeChannelAutoPatch,
 	}, uc)
 
 	unleashInstance = unleashv1.Unleash{}
@@ -467,6 +478,74 @@ func TestMergeTeamsAndNamespaces(t *testing.T) {
 	}
 }
 
+func TestValidateTeams(t *testing.T) {
+	existingTeams := []string{"team-a", "team-b"}
+
+	testCases := []struct {
+		name          string
+		allowedTeams  string
+		existingTeams []string
+		expectedError string
+	}{
+		{
+			name:          "Existing teams",
+			allowedTeams:  "team-a,team-b",
+			existingTeams: existingTeams,
+		},
+		{
+			name:          "No teams",
+			allowedTeams:  "",
+			existingTeams: existingTeams,
+		},
+		{
+			name:          "Unknown team",
+			allowedTeams:  "team-a,team-typo",
+			existingTeams: existingTeams,
+			expectedError: "Field validation for 'AllowedTeams' failed on the 'teams' tag",
+		},
+		{
+			name:         "Validation disabled",
+			allowedTeams: "team-typo",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			uc := &UnleashConfig{
+				Name:                      "my-instance",
+				FederationNonce:           "abc123",
+				AllowedTeams:              tc.allowedTeams,
+				AllowedNamespaces:         tc.allowedTeams,
+				LogLevel:                  "warn",
+				DatabasePoolMax:           3,
+				DatabasePoolIdleTimeoutMs: 1000,
+			}
+
+			err := uc.Validate(tc.existingTeams)
+
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateReservedNames(t *testing.T) {
+	for _, name := range ReservedNames {
+		uc := &UnleashConfig{
+			Name:                      name,
+			FederationNonce:           "abc123",
+			LogLevel:                  "warn",
+			DatabasePoolMax:           3,
+			DatabasePoolIdleTimeoutMs: 1000,
+		}
+
+		assert.ErrorContains(t, uc.Validate(nil), "Field validation for 'Name' failed on the 'unreserved' tag", name)
+	}
+}
+
 func TestSetDefaultValues(t *testing.T) {
 	uc := &UnleashConfig{}
 
@@ -0,0 +1,88 @@
+package unleash
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/nais/bifrost/pkg/metrics"
+	"github.com/nais/bifrost/pkg/tracing"
+)
+
+// provisionStep is a single step in provisioning an Unleash instance. If a
+// later step fails, compensate is called to undo what run created.
+type provisionStep struct {
+	name       string
+	run        func(ctx context.Context) error
+	compensate func(ctx context.Context) error
+}
+
+// runProvisionSteps runs the steps provisioning the named instance in order
+// and stops at the first failure. Steps that already completed are
+// compensated in reverse order before the error is returned.
+func runProvisionSteps(ctx context.Context, name string, steps []provisionStep) error {
+	completed := []provisionStep{}
+
+	for _, step := range steps {
+		log := logging.FromContext(ctx).WithField("step", step.name)
+
+		start := time.Now()
+		if err := runTraced(ctx, "provision "+step.name, name, step.run); err != nil {
+			metrics.ObserveProvisionStep(step.name, metrics.OutcomeFailure, time.Since(start))
+			log.WithError(err).Errorf("Provisioning step %s failed, rolling back", step.name)
+			return rollbackProvisionSteps(ctx, name, step.name, err, completed)
+		}
+		metrics.ObserveProvisionStep(step.name, metrics.OutcomeSuccess, time.Since(start))
+		log.WithField("duration_ms", time.Since(start).Milliseconds()).Debugf("Provisioning step %s completed", step.name)
+		completed = append(completed, step)
+	}
+
+	return nil
+}
+
+// runTraced runs fn in a span named after the step.
+func runTraced(ctx context.Context, spanName, name string, fn func(ctx context.Context) error) error {
+	ctx, span := tracing.Start(ctx, spanName, tracing.Instance(name))
+	err := fn(ctx)
+	tracing.End(span, err)
+
+	return err
+}
+
+func rollbackProvisionSteps(ctx context.Context, name, failedStep string, err error, completed []provisionStep) error {
+	provisionErr := &ProvisionError{
+		Step:       failedStep,
+		Err:        err,
+		RolledBack: []string{},
+	}
+
+	// Compensation must run even if the request that triggered the
+	// provisioning has been cancelled.
+	ctx = context.WithoutCancel(ctx)
+
+	rollbackErrs := []error{}
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := completed[i]
+		if step.compensate == nil {
+			continue
+		}
+
+		log := logging.FromContext(ctx).WithField("step", step.name)
+		if err := runTraced(ctx, "rollback "+step.name, name, step.compensate); err != nil {
+			metrics.CountProvisionStep(step.name, metrics.OutcomeRollbackFailed)
+			log.WithError(err).Errorf("Error rolling back provisioning step %s", step.name)
+			rollbackErrs = append(rollbackErrs, err)
+			provisionErr.NotRolledBack = append(provisionErr.NotRolledBack, step.name)
+			continue
+		}
+
+		metrics.CountProvisionStep(step.name, metrics.OutcomeRolledBack)
+		log.Infof("Rolled back provisioning step %s", step.name)
+		provisionErr.RolledBack = append(provisionErr.RolledBack, step.name)
+	}
+
+	provisionErr.RollbackErr = errors.Join(rollbackErrs...)
+
+	return provisionErr
+}
@@ -3,8 +3,13 @@ package unleash
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 
 	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/nais/bifrost/pkg/registry"
+	"github.com/nais/bifrost/pkg/tracing"
 	unleashv1 "github.com/nais/unleasherator/api/v1"
 	"github.com/sirupsen/logrus"
 	admin "google.golang.org/api/sqladmin/v1beta4"
@@ -18,6 +23,10 @@ type IUnleashService interface {
 	Create(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error)
 	Update(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error)
 	Delete(ctx context.Context, name string) error
+	Repair(ctx context.Context, name string) ([]string, error)
+	Events(ctx context.Context, name string) ([]InstanceEvent, error)
+	Pods(ctx context.Context, name string) ([]InstancePod, error)
+	Logs(ctx context.Context, name string, opts LogOptions) (io.ReadCloser, error)
 }
 
 type ISQLDatabasesService interface {
@@ -29,27 +38,54 @@ type ISQLDatabasesService interface {
 type ISQLUsersService interface {
 	Get(project string, instance string, name string) *admin.UsersGetCall
 	Insert(project string, instance string, user *admin.User) *admin.UsersInsertCall
+	Update(project string, instance string, user *admin.User) *admin.UsersUpdateCall
 	Delete(project string, instance string) *admin.UsersDeleteCall
 }
 
+// ImageResolver resolves a tag of the custom Unleash image to its digest.
+type ImageResolver interface {
+	Digest(ctx context.Context, tag string) (string, error)
+}
+
 type UnleashService struct {
 	sqlDatabasesClient ISQLDatabasesService
 	sqlUsersClient     ISQLUsersService
 	kubeClient         ctrl.Client
+	apiReader          ctrl.Reader
+	imageResolver      ImageResolver
+	logStreamer        LogStreamer
 	config             *config.Config
 	logger             *logrus.Logger
 }
 
-func NewUnleashService(sqlDatabasesClient ISQLDatabasesService, sqlUsersClient ISQLUsersService, kubeClient ctrl.Client, config *config.Config, logger *logrus.Logger) *UnleashService {
+// NewUnleashService creates an UnleashService. apiReader reads from the API
+// server when kubeClient reads from a cache, a nil apiReader reads through
+// kubeClient. Custom images are not verified if imageResolver is nil, and pod
+// logs are not available if logStreamer is nil.
+func NewUnleashService(sqlDatabasesClient ISQLDatabasesService, sqlUsersClient ISQLUsersService, kubeClient ctrl.Client, apiReader ctrl.Reader, imageResolver ImageResolver, logStreamer LogStreamer, config *config.Config, logger *logrus.Logger) *UnleashService {
+	if apiReader == nil {
+		apiReader = kubeClient
+	}
+
 	return &UnleashService{
 		sqlDatabasesClient: sqlDatabasesClient,
 		sqlUsersClient:     sqlUsersClient,
 		kubeClient:         kubeClient,
+		apiReader:          apiReader,
+		imageResolver:      imageResolver,
+		logStreamer:        logStreamer,
 		config:             config,
 		logger:             logger,
 	}
 }
 
+// logContext returns ctx with a logger for the instance. The logger of the
+// request is used if ctx has one, so the steps of a request can be followed
+// by its request ID.
+func (s *UnleashService) logContext(ctx context.Context, name string) context.Context {
+	return logging.WithFields(logging.WithDefault(ctx, s.logger), logrus.Fields{"instance": name})
+}
+
 func (s *UnleashService) List(ctx context.Context) ([]*UnleashInstance, error) {
 	instanceList := []*UnleashInstance{}
 
@@ -68,8 +104,8 @@ func (s *UnleashService) List(ctx context.Context) ([]*UnleashInstance, error) {
 		return nil, err
 	}
 
-	for _, instance := range serverList.Items {
-		instanceList = append(instanceList, NewUnleashInstance(&instance))
+	for i := range serverList.Items {
+		instanceList = append(instanceList, NewUnleashInstance(&serverList.Items[i]))
 	}
 
 	return instanceList, nil
@@ -94,35 +130,302 @@ func (s *UnleashService) Get(ctx context.Context, name string) (*UnleashInstance
 	return NewUnleashInstance(serverInstance), nil
 }
 
-func (s *UnleashService) Create(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error) {
-	database, dbErr := createDatabase(ctx, s.sqlDatabasesClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, uc.Name)
-	databaseUser, dbUserErr := createDatabaseUser(ctx, s.sqlUsersClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, uc.Name)
-	secretErr := createDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, s.config.Unleash.SQLInstanceID, s.config.Unleash.SQLInstanceAddress, s.config.Google.ProjectID, database, databaseUser)
-	fqdnError := createFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, database.Name)
-	unleashInstance, serverError := createServer(ctx, s.kubeClient, s.config, uc)
+// resolveCustomImage checks that the custom image exists in the registry and
+// records its digest on uc.
+func (s *UnleashService) resolveCustomImage(ctx context.Context, uc *UnleashConfig) error {
+	if uc.CustomVersion == "" {
+		return nil
+	}
+
+	if !registry.ValidTag(uc.CustomVersion) {
+		return &ValidationError{
+			Field:  "CustomVersion",
+			Reason: fmt.Sprintf("%q is not a valid image tag", uc.CustomVersion),
+		}
+	}
+
+	if s.imageResolver == nil {
+		return nil
+	}
 
-	if err := errors.Join(dbErr, dbUserErr, secretErr, fqdnError, serverError); err != nil {
+	digest, err := s.imageResolver.Digest(ctx, uc.CustomVersion)
+	if errors.Is(err, registry.ErrManifestNotFound) {
+		return &ValidationError{
+			Field:  "CustomVersion",
+			Reason: fmt.Sprintf("image %s does not exist", customImageForVersion(uc.CustomVersion)),
+		}
+	} else if err != nil {
+		return &UnleashError{Err: err, Reason: "failed to look up custom image"}
+	}
+
+	uc.CustomImageDigest = digest
+
+	return nil
+}
+
+// currentCustomImageDigest returns the digest recorded on the server if it
+// already runs the custom version in uc, so edits that keep the version do
+// not look the image up again.
+func (s *UnleashService) currentCustomImageDigest(ctx context.Context, uc *UnleashConfig) string {
+	if uc.CustomVersion == "" {
+		return ""
+	}
+
+	server, err := getServer(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, uc.Name)
+	if err != nil || server.Spec.CustomImage != customImageForVersion(uc.CustomVersion) {
+		return ""
+	}
+
+	return server.GetAnnotations()[CustomImageDigestAnnotation]
+}
+
+func (s *UnleashService) Create(ctx context.Context, uc *UnleashConfig) (_ *unleashv1.Unleash, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Create", tracing.Instance(uc.Name))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = s.logContext(ctx, uc.Name)
+	log := logging.FromContext(ctx)
+
+	if err := s.resolveCustomImage(ctx, uc); err != nil {
+		return nil, err
+	}
+
+	var (
+		database        *admin.Database
+		databaseUser    *admin.User
+		unleashInstance *unleashv1.Unleash
+	)
+
+	steps := []provisionStep{
+		{
+			name: "database",
+			run: func(ctx context.Context) (err error) {
+				database, err = createDatabase(ctx, s.sqlDatabasesClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, uc.Name)
+				return err
+			},
+			compensate: func(ctx context.Context) error {
+				return deleteDatabase(ctx, s.sqlDatabasesClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, uc.Name)
+			},
+		},
+		{
+			name: "database user",
+			run: func(ctx context.Context) (err error) {
+				databaseUser, err = createDatabaseUser(ctx, s.sqlUsersClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, uc.Name)
+				return err
+			},
+			compensate: func(ctx context.Context) error {
+				return deleteDatabaseUser(ctx, s.sqlUsersClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, uc.Name)
+			},
+		},
+		{
+			name: "database user secret",
+			run: func(ctx context.Context) error {
+				return createDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, s.config.Unleash.SQLInstanceID, s.config.Unleash.SQLInstanceAddress, s.config.Google.ProjectID, database, databaseUser)
+			},
+			compensate: func(ctx context.Context) error {
+				return deleteDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, uc.Name)
+			},
+		},
+		{
+			name: "fqdn network policy",
+			run: func(ctx context.Context) error {
+				return createFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, uc.Name)
+			},
+			compensate: func(ctx context.Context) error {
+				return deleteFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, uc.Name)
+			},
+		},
+		{
+			name: "server",
+			run: func(ctx context.Context) (err error) {
+				unleashInstance, err = createServer(ctx, s.kubeClient, s.config, uc)
+				return err
+			},
+		},
+	}
+
+	log.Info("Creating Unleash instance")
+	if err := runProvisionSteps(ctx, uc.Name, steps); err != nil {
 		return nil, err
 	}
+	log.Info("Created Unleash instance")
+
 	return unleashInstance, nil
 }
 
-func (s *UnleashService) Update(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error) {
+func (s *UnleashService) Update(ctx context.Context, uc *UnleashConfig) (_ *unleashv1.Unleash, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Update", tracing.Instance(uc.Name))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = s.logContext(ctx, uc.Name)
+	log := logging.FromContext(ctx)
+
+	if digest := s.currentCustomImageDigest(ctx, uc); digest != "" {
+		uc.CustomImageDigest = digest
+	} else if err := s.resolveCustomImage(ctx, uc); err != nil {
+		return nil, err
+	}
+
+	log.WithField("custom_version", uc.CustomVersion).Info("Updating Unleash instance")
+
 	fqdnError := updateFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, uc.Name)
 	unleashInstance, serverError := updateServer(ctx, s.kubeClient, s.config, uc)
 
 	if err := errors.Join(fqdnError, serverError); err != nil {
+		log.WithError(err).Error("Error updating Unleash instance")
 		return nil, err
 	}
 	return unleashInstance, nil
 }
 
-func (s *UnleashService) Delete(ctx context.Context, name string) error {
+// RecordEvent records a Kubernetes event on the Unleash server, e.g. for
+// changes bifrost makes without a user asking for them.
+func (s *UnleashService) RecordEvent(ctx context.Context, server *unleashv1.Unleash, eventType, reason, message string) error {
+	return createServerEvent(ctx, s.kubeClient, server, eventType, reason, message)
+}
+
+// Events returns the Kubernetes events for the instance and the resources
+// Unleasherator created for it, newest first.
+func (s *UnleashService) Events(ctx context.Context, name string) ([]InstanceEvent, error) {
+	return listServerEvents(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+}
+
+// Pods returns the pods running the instance, newest first.
+func (s *UnleashService) Pods(ctx context.Context, name string) ([]InstancePod, error) {
+	return listServerPods(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+}
+
+// Logs opens the logs of the Unleash or sql-proxy container of the instance.
+func (s *UnleashService) Logs(ctx context.Context, name string, opts LogOptions) (io.ReadCloser, error) {
+	return streamServerLogs(ctx, s.kubeClient, s.logStreamer, s.config.Unleash.InstanceNamespace, name, opts)
+}
+
+func (s *UnleashService) Delete(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Delete", tracing.Instance(name))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = s.logContext(ctx, name)
+	log := logging.FromContext(ctx)
+
+	log.Info("Deleting Unleash instance")
 	serverErr := deleteServer(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
 	netPolErr := deleteFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
 	dbUserSecretErr := deleteDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
 	dbErr := deleteDatabase(ctx, s.sqlDatabasesClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, name)
 	dbUserErr := deleteDatabaseUser(ctx, s.sqlUsersClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, name)
 
-	return errors.Join(serverErr, netPolErr, dbUserSecretErr, dbUserErr, dbErr)
+	if err := errors.Join(serverErr, netPolErr, dbUserSecretErr, dbUserErr, dbErr); err != nil {
+		log.WithError(err).Error("Error deleting Unleash instance")
+		return err
+	}
+	log.Info("Deleted Unleash instance")
+
+	return nil
+}
+
+// Repair recreates any of the resources making up an Unleash instance that are
+// missing, and returns the names of the resources that were recreated. It
+// returns ErrInstanceNotFound if none of the resources exist, and
+// ErrServerNotRepairable after repairing the rest if the server is missing.
+// Existence is checked against the API server rather than the cache, so a
+// stale cache does not cause resources to be created twice.
+func (s *UnleashService) Repair(ctx context.Context, name string) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Repair", tracing.Instance(name))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = s.logContext(ctx, name)
+	repaired := []string{}
+
+	projectID := s.config.Google.ProjectID
+	sqlInstanceID := s.config.Unleash.SQLInstanceID
+	namespace := s.config.Unleash.InstanceNamespace
+
+	_, err = getDatabase(ctx, s.sqlDatabasesClient, projectID, sqlInstanceID, name)
+	if err != nil && !IsNotFound(err) {
+		return repaired, err
+	}
+	databaseExists := err == nil
+
+	secret, err := getDatabaseUserSecret(ctx, s.apiReader, namespace, name)
+	if err != nil && !IsNotFound(err) {
+		return repaired, err
+	}
+	secretExists := err == nil
+
+	_, err = getDatabaseUser(ctx, s.sqlUsersClient, projectID, sqlInstanceID, name)
+	if err != nil && !IsNotFound(err) {
+		return repaired, err
+	}
+	userExists := err == nil
+
+	_, err = getFQDNNetworkPolicy(ctx, s.apiReader, namespace, name)
+	if err != nil && !IsNotFound(err) {
+		return repaired, err
+	}
+	policyExists := err == nil
+
+	_, err = getServer(ctx, s.apiReader, namespace, name)
+	if err != nil && !IsNotFound(err) {
+		return repaired, err
+	}
+	serverExists := err == nil
+
+	// A name without any resources is more likely a typo than an instance
+	// to recreate, so it is left to Create.
+	if !databaseExists && !secretExists && !userExists && !policyExists && !serverExists {
+		return repaired, fmt.Errorf("%w: %s", ErrInstanceNotFound, name)
+	}
+
+	if !databaseExists {
+		if _, err := createDatabase(ctx, s.sqlDatabasesClient, projectID, sqlInstanceID, name); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "database")
+	}
+
+	var databaseUser *admin.User
+
+	switch {
+	case !userExists && secretExists:
+		// Recreate the user with the password the instance is already configured with
+		password := string(secret.Data["POSTGRES_PASSWORD"])
+		if _, err := createDatabaseUserWithPassword(ctx, s.sqlUsersClient, projectID, sqlInstanceID, name, password); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "database user")
+	case !userExists && !secretExists:
+		if databaseUser, err = createDatabaseUser(ctx, s.sqlUsersClient, projectID, sqlInstanceID, name); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "database user")
+	case userExists && !secretExists:
+		// The existing password can not be recovered, so a new one is set
+		if databaseUser, err = resetDatabaseUserPassword(ctx, s.sqlUsersClient, projectID, sqlInstanceID, name); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "database user password")
+	}
+
+	if !secretExists {
+		database := &admin.Database{Name: name}
+		if err := createDatabaseUserSecret(ctx, s.kubeClient, namespace, sqlInstanceID, s.config.Unleash.SQLInstanceAddress, projectID, database, databaseUser); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "database user secret")
+	}
+
+	if !policyExists {
+		if err := createFQDNNetworkPolicy(ctx, s.kubeClient, namespace, name); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "fqdn network policy")
+	}
+
+	if !serverExists {
+		// The configuration of the instance, such as who can access it, is
+		// lost together with the server and is not guessed.
+		return repaired, fmt.Errorf("%w: %s", ErrServerNotRepairable, name)
+	}
+
+	return repaired, nil
 }
@@ -0,0 +1,542 @@
+package unleash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/logging"
+	"github.com/nais/bifrost/pkg/registry"
+	"github.com/nais/bifrost/pkg/tracing"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/api/option"
+	admin "google.golang.org/api/sqladmin/v1beta4"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	client_go_scheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// fakeSQLAdmin is a minimal stand-in for the Cloud SQL Admin API that keeps
+// databases and users in memory.
+type fakeSQLAdmin struct {
+	mu         sync.Mutex
+	databases  map[string]bool
+	users      map[string]bool
+	failInsert map[string]bool
+	failDelete map[string]bool
+}
+
+func newFakeSQLAdmin() *fakeSQLAdmin {
+	return &fakeSQLAdmin{
+		databases:  map[string]bool{},
+		users:      map[string]bool{},
+		failInsert: map[string]bool{},
+		failDelete: map[string]bool{},
+	}
+}
+
+func (f *fakeSQLAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// sql/v1beta4/projects/{project}/instances/{instance}/{kind}[/{name}]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 7 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	kind := parts[6]
+	store := f.databases
+	if kind == "users" {
+		store = f.users
+	}
+
+	name := r.URL.Query().Get("name")
+	if len(parts) > 7 {
+		name = parts[7]
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if f.failInsert[kind] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		store[body.Name] = true
+	case http.MethodGet:
+		if !store[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"name": name})
+		return
+	case http.MethodPut:
+		if !store[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	case http.MethodDelete:
+		if f.failDelete[kind] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !store[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(store, name)
+	}
+
+	_, _ = w.Write([]byte(`{"kind": "sql#operation", "status": "DONE"}`))
+}
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, fqdnV1alpha3.AddToScheme(scheme))
+	assert.NoError(t, unleashv1.AddToScheme(scheme))
+	assert.NoError(t, client_go_scheme.AddToScheme(scheme))
+	return scheme
+}
+
+func newTestService(t *testing.T, sqlAdmin *fakeSQLAdmin, funcs interceptor.Funcs, objs ...ctrl.Object) (*UnleashService, ctrl.Client) {
+	server := httptest.NewServer(sqlAdmin)
+	t.Cleanup(server.Close)
+
+	sqlService, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	assert.NoError(t, err)
+
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(newTestScheme(t)).
+		WithObjects(objs...).
+		WithInterceptorFuncs(funcs).
+		Build()
+
+	c := &config.Config{
+		Google: config.GoogleConfig{
+			ProjectID: "my-project",
+		},
+		Unleash: config.UnleashConfig{
+			InstanceNamespace:  "unleash",
+			SQLInstanceID:      "my-sql-instance",
+			SQLInstanceAddress: "1.2.3.4",
+		},
+	}
+
+	return NewUnleashService(sqlService.Databases, sqlService.Users, kubeClient, nil, nil, nil, c, logrus.New()), kubeClient
+}
+
+// failCreate makes the fake kubernetes client fail to create objects of the
+// same type as kind.
+func failCreate(kind ctrl.Object) interceptor.Funcs {
+	return interceptor.Funcs{
+		Create: func(ctx context.Context, client ctrl.WithWatch, obj ctrl.Object, opts ...ctrl.CreateOption) error {
+			if reflect.TypeOf(obj) == reflect.TypeOf(kind) {
+				return errors.New("create failed")
+			}
+			return client.Create(ctx, obj, opts...)
+		},
+	}
+}
+
+func TestUnleashServiceCreate(t *testing.T) {
+	ctx := context.Background()
+	uc := &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"}
+
+	t.Run("should create all resources", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, kubeClient := newTestService(t, sqlAdmin, interceptor.Funcs{})
+
+		instance, err := service.Create(ctx, uc)
+		assert.NoError(t, err)
+		assert.Equal(t, "my-instance", instance.Name)
+		assert.True(t, sqlAdmin.databases["my-instance"])
+		assert.True(t, sqlAdmin.users["my-instance"])
+
+		secret := &corev1.Secret{}
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash", Name: "my-instance"}, secret))
+		assert.Equal(t, "1.2.3.4", string(secret.Data["POSTGRES_HOST"]))
+
+		fqdn := &fqdnV1alpha3.FQDNNetworkPolicy{}
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash", Name: "my-instance-fqdn"}, fqdn))
+
+		server := &unleashv1.Unleash{}
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash", Name: "my-instance"}, server))
+	})
+
+	t.Run("should not run later steps when database creation fails", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		sqlAdmin.failInsert["databases"] = true
+		service, kubeClient := newTestService(t, sqlAdmin, interceptor.Funcs{})
+
+		instance, err := service.Create(ctx, uc)
+		assert.Nil(t, instance)
+
+		var provisionErr *ProvisionError
+		assert.ErrorAs(t, err, &provisionErr)
+		assert.Equal(t, "database", provisionErr.Step)
+		assert.Empty(t, provisionErr.RolledBack)
+		assert.Equal(t, "failed to provision database: failed to create database", err.Error())
+
+		assert.Empty(t, sqlAdmin.users)
+		secrets := &corev1.SecretList{}
+		assert.NoError(t, kubeClient.List(ctx, secrets))
+		assert.Empty(t, secrets.Items)
+	})
+
+	t.Run("should roll back created resources in reverse order when a later step fails", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, kubeClient := newTestService(t, sqlAdmin, failCreate(&unleashv1.Unleash{}))
+
+		instance, err := service.Create(ctx, uc)
+		assert.Nil(t, instance)
+
+		var provisionErr *ProvisionError
+		assert.ErrorAs(t, err, &provisionErr)
+		assert.Equal(t, "server", provisionErr.Step)
+		assert.Equal(t, []string{"fqdn network policy", "database user secret", "database user", "database"}, provisionErr.RolledBack)
+		assert.Empty(t, provisionErr.NotRolledBack)
+		assert.NoError(t, provisionErr.RollbackErr)
+		assert.Equal(t, "failed to provision server: failed to create server instance (rolled back: fqdn network policy, database user secret, database user, database)", err.Error())
+
+		var unleashErr *UnleashError
+		assert.ErrorAs(t, err, &unleashErr)
+		assert.Equal(t, "failed to create server instance", unleashErr.Reason)
+
+		assert.Empty(t, sqlAdmin.databases)
+		assert.Empty(t, sqlAdmin.users)
+
+		secrets := &corev1.SecretList{}
+		assert.NoError(t, kubeClient.List(ctx, secrets))
+		assert.Empty(t, secrets.Items)
+
+		policies := &fqdnV1alpha3.FQDNNetworkPolicyList{}
+		assert.NoError(t, kubeClient.List(ctx, policies))
+		assert.Empty(t, policies.Items)
+	})
+
+	t.Run("should report resources that could not be rolled back", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		sqlAdmin.failDelete["databases"] = true
+		service, _ := newTestService(t, sqlAdmin, failCreate(&corev1.Secret{}))
+
+		_, err := service.Create(ctx, uc)
+
+		var provisionErr *ProvisionError
+		assert.ErrorAs(t, err, &provisionErr)
+		assert.Equal(t, "database user secret", provisionErr.Step)
+		assert.Equal(t, []string{"database user"}, provisionErr.RolledBack)
+		assert.Equal(t, []string{"database"}, provisionErr.NotRolledBack)
+		assert.Error(t, provisionErr.RollbackErr)
+		assert.Equal(t, "failed to provision database user secret: failed to create database user secret (rolled back: database user) (rollback failed: database)", err.Error())
+		assert.True(t, sqlAdmin.databases["my-instance"])
+	})
+
+	t.Run("should log through the logger of the request", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, _ := newTestService(t, sqlAdmin, failCreate(&unleashv1.Unleash{}))
+
+		logger, hook := test.NewNullLogger()
+		requestCtx := logging.NewContext(ctx, logger.WithField("request_id", "abc123"))
+
+		_, err := service.Create(requestCtx, uc)
+		assert.Error(t, err)
+
+		messages := []string{}
+		for _, entry := range hook.AllEntries() {
+			assert.Equal(t, "abc123", entry.Data["request_id"])
+			assert.Equal(t, "my-instance", entry.Data["instance"])
+			messages = append(messages, entry.Message)
+		}
+		assert.Contains(t, messages, "Created database my-instance")
+		assert.Contains(t, messages, "Provisioning step server failed, rolling back")
+		assert.Contains(t, messages, "Deleted database my-instance")
+	})
+
+	t.Run("should trace each step", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		previous := otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		defer otel.SetTracerProvider(previous)
+
+		sqlAdmin := newFakeSQLAdmin()
+		service, _ := newTestService(t, sqlAdmin, failCreate(&unleashv1.Unleash{}))
+
+		_, err := service.Create(ctx, uc)
+		assert.Error(t, err)
+
+		steps := []string{}
+		for _, span := range exporter.GetSpans() {
+			if !strings.HasPrefix(span.Name, "provision ") && !strings.HasPrefix(span.Name, "rollback ") && span.Name != "UnleashService.Create" {
+				continue
+			}
+
+			steps = append(steps, span.Name)
+			assert.Contains(t, span.Attributes, tracing.Instance("my-instance"))
+		}
+		assert.Equal(t, []string{
+			"provision database",
+			"provision database user",
+			"provision database user secret",
+			"provision fqdn network policy",
+			"provision server",
+			"rollback fqdn network policy",
+			"rollback database user secret",
+			"rollback database user",
+			"rollback database",
+			"UnleashService.Create",
+		}, steps)
+	})
+}
+
+func TestUnleashServiceRepair(t *testing.T) {
+	ctx := context.Background()
+	uc := &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"}
+
+	t.Run("should not recreate anything for a complete instance", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, _ := newTestService(t, sqlAdmin, interceptor.Funcs{})
+
+		_, err := service.Create(ctx, uc)
+		assert.NoError(t, err)
+
+		repaired, err := service.Repair(ctx, "my-instance")
+		assert.NoError(t, err)
+		assert.Empty(t, repaired)
+	})
+
+	t.Run("should recreate missing secret and network policy", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, kubeClient := newTestService(t, sqlAdmin, interceptor.Funcs{})
+
+		_, err := service.Create(ctx, uc)
+		assert.NoError(t, err)
+
+		assert.NoError(t, deleteDatabaseUserSecret(ctx, kubeClient, "unleash", "my-instance"))
+		assert.NoError(t, deleteFQDNNetworkPolicy(ctx, kubeClient, "unleash", "my-instance"))
+
+		repaired, err := service.Repair(ctx, "my-instance")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"database user password", "database user secret", "fqdn network policy"}, repaired)
+
+		secret, err := getDatabaseUserSecret(ctx, kubeClient, "unleash", "my-instance")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, secret.Data["POSTGRES_PASSWORD"])
+
+		_, err = getFQDNNetworkPolicy(ctx, kubeClient, "unleash", "my-instance")
+		assert.NoError(t, err)
+	})
+
+	t.Run("should not create an instance that does not exist", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, kubeClient := newTestService(t, sqlAdmin, interceptor.Funcs{})
+
+		repaired, err := service.Repair(ctx, "my-instance")
+		assert.ErrorIs(t, err, ErrInstanceNotFound)
+		assert.Empty(t, repaired)
+		assert.Empty(t, sqlAdmin.databases)
+		assert.Empty(t, sqlAdmin.users)
+
+		_, err = getServer(ctx, kubeClient, "unleash", "my-instance")
+		assert.True(t, IsNotFound(err))
+	})
+
+	t.Run("should not recreate a missing server", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, kubeClient := newTestService(t, sqlAdmin, interceptor.Funcs{})
+
+		_, err := service.Create(ctx, uc)
+		assert.NoError(t, err)
+
+		server, err := getServer(ctx, kubeClient, "unleash", "my-instance")
+		assert.NoError(t, err)
+		assert.NoError(t, kubeClient.Delete(ctx, server))
+		assert.NoError(t, deleteFQDNNetworkPolicy(ctx, kubeClient, "unleash", "my-instance"))
+
+		repaired, err := service.Repair(ctx, "my-instance")
+		assert.ErrorIs(t, err, ErrServerNotRepairable)
+		assert.Equal(t, []string{"fqdn network policy"}, repaired)
+
+		_, err = getServer(ctx, kubeClient, "unleash", "my-instance")
+		assert.True(t, IsNotFound(err))
+	})
+
+	t.Run("should check for existing resources against the API server", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, kubeClient := newTestService(t, sqlAdmin, interceptor.Funcs{})
+
+		_, err := service.Create(ctx, uc)
+		assert.NoError(t, err)
+
+		// The cache has not seen any of the Kubernetes resources yet
+		service.kubeClient = fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+		service.apiReader = kubeClient
+
+		repaired, err := service.Repair(ctx, "my-instance")
+		assert.NoError(t, err)
+		assert.Empty(t, repaired)
+	})
+
+	t.Run("should recreate database user with the password from the existing secret", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, kubeClient := newTestService(t, sqlAdmin, interceptor.Funcs{})
+
+		_, err := service.Create(ctx, uc)
+		assert.NoError(t, err)
+		delete(sqlAdmin.users, "my-instance")
+
+		before, err := getDatabaseUserSecret(ctx, kubeClient, "unleash", "my-instance")
+		assert.NoError(t, err)
+
+		repaired, err := service.Repair(ctx, "my-instance")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"database user"}, repaired)
+		assert.True(t, sqlAdmin.users["my-instance"])
+
+		after, err := getDatabaseUserSecret(ctx, kubeClient, "unleash", "my-instance")
+		assert.NoError(t, err)
+		assert.Equal(t, before.Data, after.Data)
+	})
+}
+
+type fakeImageResolver map[string]string
+
+func (f fakeImageResolver) Digest(ctx context.Context, tag string) (string, error) {
+	digest, ok := f[tag]
+	if !ok {
+		return "", registry.ErrManifestNotFound
+	}
+	return digest, nil
+}
+
+func TestUnleashServiceCustomImage(t *testing.T) {
+	ctx := context.Background()
+	resolver := fakeImageResolver{"v5.10.2-20240329-070801-0180a96": "sha256:abc123"}
+
+	t.Run("should record the digest of an existing image", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, kubeClient := newTestService(t, sqlAdmin, interceptor.Funcs{})
+		service.imageResolver = resolver
+
+		uc := &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", CustomVersion: "v5.10.2-20240329-070801-0180a96"}
+		_, err := service.Create(ctx, uc)
+		assert.NoError(t, err)
+
+		server := &unleashv1.Unleash{}
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash", Name: "my-instance"}, server))
+		assert.Equal(t, "sha256:abc123", server.Annotations[CustomImageDigestAnnotation])
+	})
+
+	t.Run("should reject an image that does not exist before creating anything", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, _ := newTestService(t, sqlAdmin, interceptor.Funcs{})
+		service.imageResolver = resolver
+
+		uc := &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", CustomVersion: "v0.0.0-typo"}
+		_, err := service.Create(ctx, uc)
+
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "CustomVersion", validationErr.Field)
+		assert.Equal(t, "Key: 'UnleashConfig.CustomVersion' Error:image europe-north1-docker.pkg.dev/nais-io/nais/images/unleash-v4:v0.0.0-typo does not exist", err.Error())
+		assert.Empty(t, sqlAdmin.databases)
+	})
+
+	t.Run("should reject a version that is not an image tag before looking it up", func(t *testing.T) {
+		sqlAdmin := newFakeSQLAdmin()
+		service, _ := newTestService(t, sqlAdmin, interceptor.Funcs{})
+		service.imageResolver = resolver
+
+		uc := &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", CustomVersion: "../v1/../manifests/latest"}
+		_, err := service.Create(ctx, uc)
+
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "CustomVersion", validationErr.Field)
+		assert.Equal(t, `Key: 'UnleashConfig.CustomVersion' Error:"../v1/../manifests/latest" is not a valid image tag`, err.Error())
+		assert.Empty(t, sqlAdmin.databases)
+	})
+
+	t.Run("should reject an update to an image that does not exist", func(t *testing.T) {
+		existing := UnleashDefinition(&config.Config{Unleash: config.UnleashConfig{InstanceNamespace: "unleash"}}, &UnleashConfig{Name: "my-instance"})
+		service, _ := newTestService(t, newFakeSQLAdmin(), interceptor.Funcs{}, &existing)
+		service.imageResolver = resolver
+
+		_, err := service.Update(ctx, &UnleashConfig{Name: "my-instance", CustomVersion: "v0.0.0-typo"})
+
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("should keep the recorded digest without a lookup when the version is unchanged", func(t *testing.T) {
+		c := &config.Config{Unleash: config.UnleashConfig{InstanceNamespace: "unleash"}}
+		existing := UnleashDefinition(c, &UnleashConfig{Name: "my-instance", CustomVersion: "v5.10.2-20240329-070801-0180a96", CustomImageDigest: "sha256:abc123"})
+		fqdn := FQDNNetworkPolicyDefinition("my-instance", "unleash")
+		service, _ := newTestService(t, newFakeSQLAdmin(), interceptor.Funcs{}, &existing, &fqdn)
+		service.imageResolver = fakeImageResolver{}
+
+		server, err := service.Update(ctx, &UnleashConfig{Name: "my-instance", CustomVersion: "v5.10.2-20240329-070801-0180a96", LogLevel: "debug"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "sha256:abc123", server.Annotations[CustomImageDigestAnnotation])
+	})
+}
+
+func TestUpdateServerAnnotations(t *testing.T) {
+	ctx := context.Background()
+	c := &config.Config{Unleash: config.UnleashConfig{InstanceNamespace: "unleash"}}
+
+	existing := UnleashDefinition(c, &UnleashConfig{Name: "my-instance", CustomImageDigest: "sha256:abc123", UpgradeChannel: UpgradeChannelAutoMinor})
+	existing.Annotations["kubectl.kubernetes.io/last-applied-configuration"] = "{}"
+	_, kubeClient := newTestService(t, newFakeSQLAdmin(), interceptor.Funcs{}, &existing)
+
+	server, err := updateServer(ctx, kubeClient, c, &UnleashConfig{Name: "my-instance", UpgradeChannel: UpgradeChannelAutoPatch})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+		UpgradeChannelAnnotation:                           UpgradeChannelAutoPatch,
+	}, server.Annotations)
+}
+
+func TestUnleashServiceRecordEvent(t *testing.T) {
+	ctx := context.Background()
+	c := &config.Config{Unleash: config.UnleashConfig{InstanceNamespace: "unleash"}}
+
+	server := UnleashDefinition(c, &UnleashConfig{Name: "my-instance"})
+	service, kubeClient := newTestService(t, newFakeSQLAdmin(), interceptor.Funcs{}, &server)
+
+	assert.NoError(t, service.RecordEvent(ctx, &server, corev1.EventTypeNormal, "AutoUpgraded", "Upgraded"))
+
+	events := &corev1.EventList{}
+	assert.NoError(t, kubeClient.List(ctx, events, ctrl.InNamespace("unleash")))
+	assert.Len(t, events.Items, 1)
+	assert.Equal(t, "Unleash", events.Items[0].InvolvedObject.Kind)
+	assert.Equal(t, "my-instance", events.Items[0].InvolvedObject.Name)
+	assert.Equal(t, "AutoUpgraded", events.Items[0].Reason)
+	assert.Equal(t, corev1.EventTypeNormal, events.Items[0].Type)
+}
@@ -0,0 +1,118 @@
+package unleash
+
+import (
+	"time"
+
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Status is the state of an instance derived from the conditions Unleasherator
+// sets on the Unleash resource.
+type Status string
+
+const (
+	// StatusProvisioning is an instance Unleasherator has not finished
+	// reconciling, including one that does not run its custom version yet.
+	StatusProvisioning Status = "Provisioning"
+	// StatusReady is an instance that is reconciled and reachable.
+	StatusReady Status = "Ready"
+	// StatusDegraded is a reconciled instance that Unleasherator cannot
+	// connect to, or that it has marked as degraded.
+	StatusDegraded Status = "Degraded"
+	// StatusFailed is an instance that Unleasherator failed to reconcile.
+	StatusFailed Status = "Failed"
+	// StatusDeleting is an instance that is being deleted.
+	StatusDeleting Status = "Deleting"
+	// StatusUnknown is an instance without an Unleash resource.
+	StatusUnknown Status = "Unknown"
+)
+
+// Label returns the colour of the UI label for the status.
+func (s Status) Label() string {
+	switch s {
+	case StatusReady:
+		return "green"
+	case StatusProvisioning:
+		return "blue"
+	case StatusDegraded:
+		return "yellow"
+	case StatusFailed:
+		return "red"
+	case StatusDeleting:
+		return "grey"
+	default:
+		return "orange"
+	}
+}
+
+// Condition is a condition from the status of the Unleash resource.
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason"`
+	Message            string    `json:"message"`
+	LastTransitionTime time.Time `json:"last-transition-time"`
+}
+
+// Conditions returns the conditions of the Unleash resource with transition
+// times in UTC.
+func (u *UnleashInstance) Conditions() []Condition {
+	conditions := []Condition{}
+	if u.ServerInstance == nil {
+		return conditions
+	}
+
+	for _, condition := range u.ServerInstance.Status.Conditions {
+		conditions = append(conditions, Condition{
+			Type:               condition.Type,
+			Status:             string(condition.Status),
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+			LastTransitionTime: condition.LastTransitionTime.UTC(),
+		})
+	}
+
+	return conditions
+}
+
+func serverStatus(server *unleashv1.Unleash) Status {
+	if server == nil {
+		return StatusUnknown
+	}
+
+	if server.GetDeletionTimestamp() != nil {
+		return StatusDeleting
+	}
+
+	conditions := server.Status.Conditions
+
+	if meta.IsStatusConditionTrue(conditions, unleashv1.UnleashStatusConditionTypeDegraded) {
+		return StatusDegraded
+	}
+
+	// A failed reconcile never rolls out, so it is reported before waiting
+	// for the rollout.
+	if meta.IsStatusConditionFalse(conditions, unleashv1.UnleashStatusConditionTypeReconciled) {
+		return StatusFailed
+	}
+
+	if !rolledOut(server) {
+		return StatusProvisioning
+	}
+
+	if !meta.IsStatusConditionTrue(conditions, unleashv1.UnleashStatusConditionTypeReconciled) {
+		return StatusProvisioning
+	}
+
+	connected := meta.FindStatusCondition(conditions, unleashv1.UnleashStatusConditionTypeConnected)
+	switch {
+	case connected == nil || connected.Status == metav1.ConditionUnknown:
+		return StatusProvisioning
+	case connected.Status == metav1.ConditionTrue:
+		return StatusReady
+	default:
+		return StatusDegraded
+	}
+}
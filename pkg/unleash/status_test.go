@@ -0,0 +1,139 @@
+package unleash
+
+import (
+	"testing"
+	"time"
+
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUnleashInstanceStatus(t *testing.T) {
+	condition := func(conditionType string, status metav1.ConditionStatus, generation int64) metav1.Condition {
+		return metav1.Condition{Type: conditionType, Status: status, ObservedGeneration: generation}
+	}
+
+	reconciled := unleashv1.UnleashStatusConditionTypeReconciled
+	connected := unleashv1.UnleashStatusConditionTypeConnected
+	degraded := unleashv1.UnleashStatusConditionTypeDegraded
+
+	tests := []struct {
+		name       string
+		deleting   bool
+		image      string
+		version    string
+		conditions []metav1.Condition
+		want       Status
+	}{
+		{
+			name: "no conditions",
+			want: StatusProvisioning,
+		},
+		{
+			name:       "reconciling",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionUnknown, 2)},
+			want:       StatusProvisioning,
+		},
+		{
+			name:       "waiting for connection",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionTrue, 2)},
+			want:       StatusProvisioning,
+		},
+		{
+			name:       "ready",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionTrue, 2), condition(connected, metav1.ConditionTrue, 2)},
+			want:       StatusReady,
+		},
+		{
+			name:       "previous generation",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionTrue, 1), condition(connected, metav1.ConditionTrue, 1)},
+			want:       StatusProvisioning,
+		},
+		{
+			name:       "custom version not running",
+			image:      customImageForVersion("v5.10.2-20240329-070801-0180a96"),
+			version:    "5.9.0",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionTrue, 0), condition(connected, metav1.ConditionTrue, 0)},
+			want:       StatusProvisioning,
+		},
+		{
+			name:       "custom version running",
+			image:      customImageForVersion("v5.10.2-20240329-070801-0180a96"),
+			version:    "5.10.2",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionTrue, 0), condition(connected, metav1.ConditionTrue, 0)},
+			want:       StatusReady,
+		},
+		{
+			name:       "custom version failed before running",
+			image:      customImageForVersion("v5.10.2-20240329-070801-0180a96"),
+			version:    "",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionFalse, 0)},
+			want:       StatusFailed,
+		},
+		{
+			name:       "not connected",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionTrue, 2), condition(connected, metav1.ConditionFalse, 2)},
+			want:       StatusDegraded,
+		},
+		{
+			name:       "degraded",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionTrue, 2), condition(connected, metav1.ConditionTrue, 2), condition(degraded, metav1.ConditionTrue, 2)},
+			want:       StatusDegraded,
+		},
+		{
+			name:       "failed",
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionFalse, 2)},
+			want:       StatusFailed,
+		},
+		{
+			name:       "deleting",
+			deleting:   true,
+			conditions: []metav1.Condition{condition(reconciled, metav1.ConditionTrue, 2), condition(connected, metav1.ConditionTrue, 2)},
+			want:       StatusDeleting,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &unleashv1.Unleash{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+			server.Spec.CustomImage = tt.image
+			server.Status.Version = tt.version
+			server.Status.Conditions = tt.conditions
+			if tt.deleting {
+				now := metav1.Now()
+				server.DeletionTimestamp = &now
+			}
+
+			instance := &UnleashInstance{ServerInstance: server}
+			assert.Equal(t, tt.want, instance.Status())
+		})
+	}
+}
+
+func TestUnleashInstanceConditions(t *testing.T) {
+	oslo, _ := time.LoadLocation("Europe/Oslo")
+	since := time.Date(2024, 1, 2, 3, 4, 5, 0, oslo)
+
+	instance := &UnleashInstance{ServerInstance: &unleashv1.Unleash{
+		Status: unleashv1.UnleashStatus{
+			Conditions: []metav1.Condition{{
+				Type:               unleashv1.UnleashStatusConditionTypeConnected,
+				Status:             metav1.ConditionFalse,
+				Reason:             "Reconciling",
+				Message:            "Failed to connect to Unleash instance",
+				LastTransitionTime: metav1.NewTime(since),
+			}},
+		},
+	}}
+
+	assert.Equal(t, []Condition{{
+		Type:               unleashv1.UnleashStatusConditionTypeConnected,
+		Status:             "False",
+		Reason:             "Reconciling",
+		Message:            "Failed to connect to Unleash instance",
+		LastTransitionTime: since.UTC(),
+	}}, instance.Conditions())
+
+	assert.Equal(t, []Condition{}, (&UnleashInstance{}).Conditions())
+}
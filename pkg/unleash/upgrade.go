@@ -0,0 +1,444 @@
+package unleash
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nais/bifrost/pkg/github"
+	"github.com/nais/bifrost/pkg/utils"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+)
+
+// UpgradeFilter selects the instances of a fleet upgrade. Empty fields match
+// every instance.
+type UpgradeFilter struct {
+	// OlderThan matches instances running a version older than this
+	// semantic version, e.g. "5.10.0".
+	OlderThan string `json:"older-than,omitempty" form:"older-than"`
+	// Team matches instances the team is allowed to access.
+	Team string `json:"team,omitempty" form:"team"`
+	// NamePattern matches instance names using shell glob syntax, e.g.
+	// "team-*".
+	NamePattern string `json:"name-pattern,omitempty" form:"name-pattern"`
+}
+
+// Validate checks that the version and pattern of the filter can be parsed.
+func (f UpgradeFilter) Validate() error {
+	if f.OlderThan != "" {
+		if _, err := github.ParseSemver(f.OlderThan); err != nil {
+			return &ValidationError{Field: "OlderThan", Reason: err.Error()}
+		}
+	}
+
+	if _, err := path.Match(f.NamePattern, ""); err != nil {
+		return &ValidationError{Field: "NamePattern", Reason: fmt.Sprintf("invalid pattern %q", f.NamePattern)}
+	}
+
+	return nil
+}
+
+func (f UpgradeFilter) matches(instance *UnleashInstance) bool {
+	if instance.ServerInstance == nil {
+		return false
+	}
+
+	if f.NamePattern != "" {
+		if ok, _ := path.Match(f.NamePattern, instance.Name); !ok {
+			return false
+		}
+	}
+
+	if f.Team != "" {
+		uc := UnleashVariables(instance.ServerInstance, true)
+		if !slices.Contains(utils.SplitNoEmpty(uc.AllowedTeams, ","), f.Team) {
+			return false
+		}
+	}
+
+	if f.OlderThan != "" {
+		olderThan, _ := github.ParseSemver(f.OlderThan)
+		current, ok := instanceSemver(instance)
+		if !ok || current.Compare(olderThan) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// instanceSemver returns the version of the custom image an instance runs, or
+// the version reported by Unleash if it runs the default image.
+func instanceSemver(instance *UnleashInstance) (github.Semver, bool) {
+	if image := instance.ServerInstance.Spec.CustomImage; image != "" {
+		versions := github.UnleashVersionsFromTags([]string{versionFromImage(image)})
+		if len(versions) == 1 {
+			return versions[0].Semver, true
+		}
+	}
+
+	version, err := github.ParseSemver(instance.ServerInstance.Status.Version)
+	if err != nil {
+		return github.Semver{}, false
+	}
+
+	return version, true
+}
+
+// PlannedUpgrade is an instance that will be moved to the target version.
+type PlannedUpgrade struct {
+	Name        string `json:"name"`
+	FromVersion string `json:"from-version"`
+	FromImage   string `json:"from-image"`
+}
+
+// UpgradePlan lists the instances a fleet upgrade will update, in the order
+// they are upgraded.
+type UpgradePlan struct {
+	Version   string           `json:"version"`
+	Filter    UpgradeFilter    `json:"filter"`
+	Instances []PlannedUpgrade `json:"instances"`
+}
+
+// PlanUpgrade selects the instances matching filter that do not already run
+// the custom version.
+func PlanUpgrade(ctx context.Context, service IUnleashService, version string, filter UpgradeFilter) (*UpgradePlan, error) {
+	if version == "" {
+		return nil, &ValidationError{Field: "Version", Reason: "target version is required"}
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	instances, err := service.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &UpgradePlan{Version: version, Filter: filter, Instances: []PlannedUpgrade{}}
+	for _, instance := range instances {
+		if !filter.matches(instance) || instance.ServerInstance.Spec.CustomImage == customImageForVersion(version) {
+			continue
+		}
+
+		plan.Instances = append(plan.Instances, PlannedUpgrade{
+			Name:        instance.Name,
+			FromVersion: instance.Version(),
+			FromImage:   instance.ServerInstance.Spec.CustomImage,
+		})
+	}
+
+	slices.SortFunc(plan.Instances, func(a, b PlannedUpgrade) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return plan, nil
+}
+
+type UpgradeStatus string
+
+const (
+	UpgradePending   UpgradeStatus = "pending"
+	UpgradeRunning   UpgradeStatus = "upgrading"
+	UpgradeSucceeded UpgradeStatus = "upgraded"
+	UpgradeFailed    UpgradeStatus = "failed"
+	UpgradeSkipped   UpgradeStatus = "skipped"
+)
+
+// UpgradeResult is the outcome of upgrading a single instance.
+type UpgradeResult struct {
+	Name   string        `json:"name"`
+	Status UpgradeStatus `json:"status"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// UpgradeOptions control how a fleet upgrade is rolled out.
+type UpgradeOptions struct {
+	// Concurrency is the number of instances upgraded at the same time.
+	Concurrency int
+	// ReadyTimeout is how long to wait for an upgraded instance to become
+	// ready.
+	ReadyTimeout time.Duration
+	// PollInterval is how often readiness is checked.
+	PollInterval time.Duration
+}
+
+// RunUpgrade sets the custom image of every instance in the plan and waits for
+// it to become ready. No new instances are started after the first failure;
+// those are reported as skipped and the first error is returned. report is
+// called whenever the status of an instance changes.
+func RunUpgrade(ctx context.Context, service IUnleashService, plan *UpgradePlan, opts UpgradeOptions, report func(UpgradeResult)) error {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	queue := make(chan PlannedUpgrade)
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for planned := range queue {
+				mu.Lock()
+				halted := firstErr != nil
+				mu.Unlock()
+
+				if halted {
+					report(UpgradeResult{Name: planned.Name, Status: UpgradeSkipped})
+					continue
+				}
+
+				report(UpgradeResult{Name: planned.Name, Status: UpgradeRunning})
+
+				if err := upgradeInstance(ctx, service, planned.Name, plan.Version, opts); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("upgrading %s: %w", planned.Name, err)
+					}
+					mu.Unlock()
+
+					report(UpgradeResult{Name: planned.Name, Status: UpgradeFailed, Error: err.Error()})
+					continue
+				}
+
+				report(UpgradeResult{Name: planned.Name, Status: UpgradeSucceeded})
+			}
+		}()
+	}
+
+	for _, planned := range plan.Instances {
+		queue <- planned
+	}
+	close(queue)
+	wg.Wait()
+
+	return firstErr
+}
+
+func upgradeInstance(ctx context.Context, service IUnleashService, name, version string, opts UpgradeOptions) error {
+	instance, err := service.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	uc := UnleashVariables(instance.ServerInstance, true)
+	uc.CustomVersion = version
+
+	if _, err := service.Update(ctx, uc); err != nil {
+		return err
+	}
+
+	return waitForReady(ctx, service, name, version, opts)
+}
+
+// waitForReady polls the instance until it is ready and Unleash reports
+// running the custom version.
+func waitForReady(ctx context.Context, service IUnleashService, name, version string, opts UpgradeOptions) error {
+	if opts.ReadyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ReadyTimeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		instance, err := service.Get(ctx, name)
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+
+		if err == nil && instance.ServerInstance != nil && instance.ServerInstance.Spec.CustomImage == customImageForVersion(version) && instance.IsReady() && rolledOut(instance.ServerInstance) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("not ready after %s", opts.ReadyTimeout)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// rolledOut reports whether Unleasherator has caught up with the latest
+// change to server. Unleasherator does not set the observed generation of its
+// conditions, so the conditions of an instance whose image was just changed
+// still read ready; the version Unleash reports is what tells that the custom
+// image is running. Instances on the default image, or on a tag that is not a
+// version, only have their conditions checked.
+func rolledOut(server *unleashv1.Unleash) bool {
+	for _, condition := range server.Status.Conditions {
+		if condition.ObservedGeneration != 0 && condition.ObservedGeneration < server.GetGeneration() {
+			return false
+		}
+	}
+
+	image := server.Spec.CustomImage
+	if image == "" {
+		return true
+	}
+
+	versions := github.UnleashVersionsFromTags([]string{versionFromImage(image)})
+	if len(versions) != 1 {
+		return true
+	}
+
+	reported, err := github.ParseSemver(server.Status.Version)
+	return err == nil && reported.Compare(versions[0].Semver) == 0
+}
+
+// UpgradeRun is the progress of a fleet upgrade running in the background.
+type UpgradeRun struct {
+	Plan       *UpgradePlan    `json:"plan"`
+	Results    []UpgradeResult `json:"results"`
+	StartedAt  time.Time       `json:"started-at"`
+	FinishedAt *time.Time      `json:"finished-at,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Done reports whether the upgrade has finished.
+func (r *UpgradeRun) Done() bool {
+	return r.FinishedAt != nil
+}
+
+// Upgrader runs one fleet upgrade at a time in the background and keeps the
+// progress of the latest one.
+type Upgrader struct {
+	service IUnleashService
+	opts    UpgradeOptions
+
+	mu      sync.Mutex
+	current *UpgradeRun
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+}
+
+func NewUpgrader(service IUnleashService, opts UpgradeOptions) *Upgrader {
+	return &Upgrader{
+		service: service,
+		opts:    opts,
+	}
+}
+
+// ErrUpgradeInProgress is returned when an upgrade is started while another
+// one is still running.
+var ErrUpgradeInProgress = errors.New("an upgrade is already in progress")
+
+// ErrUpgraderStopped is returned when an upgrade is started after the
+// upgrader has been stopped.
+var ErrUpgraderStopped = errors.New("upgrades are stopped")
+
+// Start begins upgrading the instances in plan. A concurrency of zero uses the
+// configured default.
+func (u *Upgrader) Start(plan *UpgradePlan, concurrency int) (*UpgradeRun, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.stopped {
+		return nil, ErrUpgraderStopped
+	}
+
+	if u.current != nil && !u.current.Done() {
+		return nil, ErrUpgradeInProgress
+	}
+
+	opts := u.opts
+	if concurrency > 0 {
+		opts.Concurrency = concurrency
+	}
+
+	run := &UpgradeRun{Plan: plan, Results: make([]UpgradeResult, len(plan.Instances)), StartedAt: time.Now()}
+	index := map[string]int{}
+	for i, planned := range plan.Instances {
+		run.Results[i] = UpgradeResult{Name: planned.Name, Status: UpgradePending}
+		index[planned.Name] = i
+	}
+	u.current = run
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	u.cancel, u.done = cancel, done
+
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		err := RunUpgrade(ctx, u.service, plan, opts, func(result UpgradeResult) {
+			u.mu.Lock()
+			run.Results[index[result.Name]] = result
+			u.mu.Unlock()
+		})
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		finishedAt := time.Now()
+		run.FinishedAt = &finishedAt
+		if err != nil {
+			run.Error = err.Error()
+		}
+	}()
+
+	return u.snapshot(), nil
+}
+
+// Stop cancels the running upgrade, if any, and waits until it has recorded
+// its result or ctx is done. No upgrades can be started after Stop.
+func (u *Upgrader) Stop(ctx context.Context) error {
+	u.mu.Lock()
+	u.stopped = true
+	cancel, done := u.cancel, u.done
+	u.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Current returns a copy of the latest upgrade, or nil if none has been
+// started.
+func (u *Upgrader) Current() *UpgradeRun {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.snapshot()
+}
+
+func (u *Upgrader) snapshot() *UpgradeRun {
+	if u.current == nil {
+		return nil
+	}
+
+	run := *u.current
+	run.Results = slices.Clone(u.current.Results)
+
+	return &run
+}
@@ -0,0 +1,259 @@
+package unleash
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// upgradeTestService stores instances in memory and reports the new version
+// when they are updated. Like Unleasherator, it does not set the observed
+// generation of conditions. Updates of failing instances return an error, and
+// stuck instances keep reporting their previous version.
+type upgradeTestService struct {
+	IUnleashService
+
+	c       *config.Config
+	failing map[string]bool
+	stuck   map[string]bool
+
+	mu        sync.Mutex
+	instances map[string]*unleashv1.Unleash
+	updated   []string
+}
+
+func newUpgradeTestService(c *config.Config, servers ...*unleashv1.Unleash) *upgradeTestService {
+	s := &upgradeTestService{c: c, failing: map[string]bool{}, stuck: map[string]bool{}, instances: map[string]*unleashv1.Unleash{}}
+	for _, server := range servers {
+		s.instances[server.Name] = server
+	}
+	return s
+}
+
+func (s *upgradeTestService) List(ctx context.Context) ([]*UnleashInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instances := []*UnleashInstance{}
+	for _, server := range s.instances {
+		instances = append(instances, NewUnleashInstance(server.DeepCopy()))
+	}
+	return instances, nil
+}
+
+func (s *upgradeTestService) Get(ctx context.Context, name string) (*UnleashInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.instances[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(unleashv1.GroupVersion.WithResource("unleashes").GroupResource(), name)
+	}
+	return NewUnleashInstance(server.DeepCopy()), nil
+}
+
+func (s *upgradeTestService) Update(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updated = append(s.updated, uc.Name)
+	if s.failing[uc.Name] {
+		return nil, errors.New("update failed")
+	}
+
+	server := UnleashDefinition(s.c, uc)
+	server.Generation = s.instances[uc.Name].Generation + 1
+	server.Status = s.instances[uc.Name].Status
+	if versions := github.UnleashVersionsFromTags([]string{uc.CustomVersion}); len(versions) == 1 && !s.stuck[uc.Name] {
+		server.Status.Version = versions[0].Semver.String()
+	}
+	s.instances[uc.Name] = &server
+
+	return server.DeepCopy(), nil
+}
+
+func readyConditions() []metav1.Condition {
+	return []metav1.Condition{
+		{Type: unleashv1.UnleashStatusConditionTypeReconciled, Status: metav1.ConditionTrue},
+		{Type: unleashv1.UnleashStatusConditionTypeConnected, Status: metav1.ConditionTrue},
+	}
+}
+
+func newUpgradeTestServer(c *config.Config, name, teams, customVersion, version string) *unleashv1.Unleash {
+	server := UnleashDefinition(c, &UnleashConfig{Name: name, AllowedTeams: teams, CustomVersion: customVersion})
+	server.Generation = 1
+	server.Status.Version = version
+	server.Status.Conditions = readyConditions()
+	return &server
+}
+
+const (
+	upgradeTestOldVersion    = "v5.9.0-20240201-090000-aaaaaaa"
+	upgradeTestTargetVersion = "v5.10.2-20240329-070801-0180a96"
+)
+
+func TestPlanUpgrade(t *testing.T) {
+	c := &config.Config{}
+	service := newUpgradeTestService(c,
+		newUpgradeTestServer(c, "team-b", "team-b", upgradeTestOldVersion, "5.9.0"),
+		newUpgradeTestServer(c, "team-a", "team-a,shared", "", "5.8.1"),
+		newUpgradeTestServer(c, "other", "other,shared", "", "5.11.0"),
+		newUpgradeTestServer(c, "team-c", "team-c", upgradeTestTargetVersion, "5.10.2"),
+	)
+
+	tests := []struct {
+		name     string
+		filter   UpgradeFilter
+		expected []string
+	}{
+		{name: "all", filter: UpgradeFilter{}, expected: []string{"other", "team-a", "team-b"}},
+		{name: "older than", filter: UpgradeFilter{OlderThan: "5.10.0"}, expected: []string{"team-a", "team-b"}},
+		{name: "team", filter: UpgradeFilter{Team: "shared"}, expected: []string{"other", "team-a"}},
+		{name: "name pattern", filter: UpgradeFilter{NamePattern: "team-*"}, expected: []string{"team-a", "team-b"}},
+		{name: "combined", filter: UpgradeFilter{OlderThan: "5.9.0", NamePattern: "team-*"}, expected: []string{"team-a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PlanUpgrade(context.Background(), service, upgradeTestTargetVersion, tt.filter)
+			assert.NoError(t, err)
+
+			names := []string{}
+			for _, planned := range plan.Instances {
+				names = append(names, planned.Name)
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+
+	_, err := PlanUpgrade(context.Background(), service, upgradeTestTargetVersion, UpgradeFilter{OlderThan: "latest"})
+	assert.ErrorAs(t, err, new(*ValidationError))
+
+	_, err = PlanUpgrade(context.Background(), service, "", UpgradeFilter{})
+	assert.ErrorAs(t, err, new(*ValidationError))
+}
+
+func TestRunUpgrade(t *testing.T) {
+	c := &config.Config{}
+	service := newUpgradeTestService(c,
+		newUpgradeTestServer(c, "team-a", "team-a", upgradeTestOldVersion, "5.9.0"),
+		newUpgradeTestServer(c, "team-b", "team-b", "", "5.8.1"),
+		newUpgradeTestServer(c, "team-c", "team-c", upgradeTestOldVersion, "5.9.0"),
+	)
+
+	plan, err := PlanUpgrade(context.Background(), service, upgradeTestTargetVersion, UpgradeFilter{})
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	results := map[string]UpgradeStatus{}
+	err = RunUpgrade(context.Background(), service, plan, UpgradeOptions{Concurrency: 2, PollInterval: time.Millisecond}, func(result UpgradeResult) {
+		mu.Lock()
+		results[result.Name] = result.Status
+		mu.Unlock()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]UpgradeStatus{"team-a": UpgradeSucceeded, "team-b": UpgradeSucceeded, "team-c": UpgradeSucceeded}, results)
+
+	for _, name := range []string{"team-a", "team-b", "team-c"} {
+		assert.Equal(t, customImageForVersion(upgradeTestTargetVersion), service.instances[name].Spec.CustomImage)
+	}
+}
+
+func TestRunUpgradeHaltsOnFailure(t *testing.T) {
+	c := &config.Config{}
+	service := newUpgradeTestService(c,
+		newUpgradeTestServer(c, "team-a", "team-a", upgradeTestOldVersion, "5.9.0"),
+		newUpgradeTestServer(c, "team-b", "team-b", upgradeTestOldVersion, "5.9.0"),
+		newUpgradeTestServer(c, "team-c", "team-c", upgradeTestOldVersion, "5.9.0"),
+	)
+	service.failing["team-b"] = true
+
+	plan, err := PlanUpgrade(context.Background(), service, upgradeTestTargetVersion, UpgradeFilter{})
+	assert.NoError(t, err)
+
+	results := map[string]UpgradeResult{}
+	err = RunUpgrade(context.Background(), service, plan, UpgradeOptions{Concurrency: 1, PollInterval: time.Millisecond}, func(result UpgradeResult) {
+		results[result.Name] = result
+	})
+	assert.EqualError(t, err, "upgrading team-b: update failed")
+	assert.Equal(t, UpgradeSucceeded, results["team-a"].Status)
+	assert.Equal(t, UpgradeFailed, results["team-b"].Status)
+	assert.Equal(t, "update failed", results["team-b"].Error)
+	assert.Equal(t, UpgradeSkipped, results["team-c"].Status)
+	assert.Equal(t, []string{"team-a", "team-b"}, service.updated)
+}
+
+func TestRunUpgradeWaitsForReady(t *testing.T) {
+	c := &config.Config{}
+	service := newUpgradeTestService(c,
+		newUpgradeTestServer(c, "team-a", "team-a", upgradeTestOldVersion, "5.9.0"),
+		newUpgradeTestServer(c, "team-b", "team-b", upgradeTestOldVersion, "5.9.0"),
+	)
+	service.stuck["team-a"] = true
+
+	plan, err := PlanUpgrade(context.Background(), service, upgradeTestTargetVersion, UpgradeFilter{})
+	assert.NoError(t, err)
+
+	results := map[string]UpgradeStatus{}
+	err = RunUpgrade(context.Background(), service, plan, UpgradeOptions{ReadyTimeout: 20 * time.Millisecond, PollInterval: time.Millisecond}, func(result UpgradeResult) {
+		results[result.Name] = result.Status
+	})
+	assert.EqualError(t, err, "upgrading team-a: not ready after 20ms")
+	assert.Equal(t, map[string]UpgradeStatus{"team-a": UpgradeFailed, "team-b": UpgradeSkipped}, results)
+}
+
+func TestUpgrader(t *testing.T) {
+	c := &config.Config{}
+	service := newUpgradeTestService(c, newUpgradeTestServer(c, "team-a", "team-a", upgradeTestOldVersion, "5.9.0"))
+
+	upgrader := NewUpgrader(service, UpgradeOptions{PollInterval: time.Millisecond})
+	assert.Nil(t, upgrader.Current())
+
+	plan, err := PlanUpgrade(context.Background(), service, upgradeTestTargetVersion, UpgradeFilter{})
+	assert.NoError(t, err)
+
+	run, err := upgrader.Start(plan, 0)
+	assert.NoError(t, err)
+	assert.Len(t, run.Results, 1)
+
+	assert.Eventually(t, func() bool {
+		return upgrader.Current().Done()
+	}, time.Second, time.Millisecond)
+
+	run = upgrader.Current()
+	assert.Empty(t, run.Error)
+	assert.Equal(t, []UpgradeResult{{Name: "team-a", Status: UpgradeSucceeded}}, run.Results)
+}
+
+func TestUpgraderStop(t *testing.T) {
+	c := &config.Config{}
+	service := newUpgradeTestService(c, newUpgradeTestServer(c, "team-a", "team-a", upgradeTestOldVersion, "5.9.0"))
+	service.stuck["team-a"] = true
+
+	// Stopping an idle upgrader returns immediately
+	assert.NoError(t, NewUpgrader(service, UpgradeOptions{}).Stop(context.Background()))
+
+	upgrader := NewUpgrader(service, UpgradeOptions{ReadyTimeout: time.Minute, PollInterval: time.Millisecond})
+
+	plan, err := PlanUpgrade(context.Background(), service, upgradeTestTargetVersion, UpgradeFilter{})
+	assert.NoError(t, err)
+
+	_, err = upgrader.Start(plan, 0)
+	assert.NoError(t, err)
+
+	assert.NoError(t, upgrader.Stop(context.Background()))
+	assert.True(t, upgrader.Current().Done())
+	assert.Contains(t, upgrader.Current().Error, context.Canceled.Error())
+
+	_, err = upgrader.Start(plan, 0)
+	assert.ErrorIs(t, err, ErrUpgraderStopped)
+}